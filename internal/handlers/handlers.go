@@ -1,434 +1,1767 @@
-package handlers
-
-import (
-	"context"
-	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
-
-	"github.com/gin-gonic/gin"
-	"github.com/vairarchi/bulk-import-export-api/internal/models"
-	"github.com/vairarchi/bulk-import-export-api/pkg/jobs"
-	"github.com/vairarchi/bulk-import-export-api/pkg/streaming"
-)
-
-// Handler handles HTTP requests for import/export operations
-type Handler struct {
-	jobManager      *jobs.JobManager
-	jobProcessor    *jobs.JobProcessor
-	streamProcessor *streaming.Processor
-	idempotencyMgr  *jobs.IdempotencyManager
-	uploadsDir      string
-	exportDir       string
-	maxFileSize     int64
-}
-
-// NewHandler creates a new HTTP handler
-func NewHandler(
-	jobManager *jobs.JobManager,
-	jobProcessor *jobs.JobProcessor,
-	streamProcessor *streaming.Processor,
-	idempotencyMgr *jobs.IdempotencyManager,
-	uploadsDir, exportDir string,
-) *Handler {
-	return &Handler{
-		jobManager:      jobManager,
-		jobProcessor:    jobProcessor,
-		streamProcessor: streamProcessor,
-		idempotencyMgr:  idempotencyMgr,
-		uploadsDir:      uploadsDir,
-		exportDir:       exportDir,
-		maxFileSize:     100 * 1024 * 1024, // 100MB max file size
-	}
-}
-
-// CreateImportJob creates a new import job
-func (h *Handler) CreateImportJob(c *gin.Context) {
-	// Check idempotency key
-	idempotencyKey := c.GetHeader("Idempotency-Key")
-	if idempotencyKey != "" {
-		if jobID, exists := h.idempotencyMgr.CheckIdempotency(idempotencyKey); exists {
-			job, found := h.jobManager.GetImportJob(jobID)
-			if found {
-				c.JSON(http.StatusOK, gin.H{
-					"job_id":  jobID,
-					"status":  job.Status,
-					"message": "Job already exists for this idempotency key",
-				})
-				return
-			}
-		}
-	}
-
-	var filePath string
-	var format string
-	var resourceType string
-
-	// Check content type for multipart upload
-	contentType := c.GetHeader("Content-Type")
-	if contentType != "" && strings.HasPrefix(contentType, "multipart/form-data") {
-		// Handle multipart file upload
-		file, header, err := c.Request.FormFile("file")
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from request"})
-			return
-		}
-		defer file.Close()
-
-		// Validate file size
-		if header.Size > h.maxFileSize {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds maximum allowed size"})
-			return
-		}
-
-		// Get additional form parameters
-		resourceType = c.PostForm("resource_type")
-		format = c.PostForm("format")
-
-		// Validate required parameters
-		if resourceType == "" || format == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "resource_type and format are required"})
-			return
-		}
-
-		// Save uploaded file
-		fileName := fmt.Sprintf("%d_%s", time.Now().Unix(), header.Filename)
-		filePath = filepath.Join(h.uploadsDir, fileName)
-
-		dst, err := os.Create(filePath)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
-			return
-		}
-		defer dst.Close()
-
-		_, err = io.Copy(dst, file)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
-			return
-		}
-	} else {
-		// Handle JSON request with file URL
-		var req models.ImportRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		resourceType = req.ResourceType
-		format = req.Format
-
-		// Download file from URL
-		if req.FileURL == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file_url is required for JSON requests"})
-			return
-		}
-
-		var err error
-		filePath, err = h.downloadFile(req.FileURL)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to download file: %v", err)})
-			return
-		}
-	}
-
-	// Validate resource type and format combination
-	if !h.isValidResourceFormat(resourceType, format) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", format, resourceType),
-		})
-		return
-	}
-
-	// Create import job
-	job := h.jobManager.CreateImportJob(resourceType, filepath.Base(filePath))
-
-	// Set idempotency mapping if provided
-	if idempotencyKey != "" {
-		h.idempotencyMgr.SetIdempotency(idempotencyKey, job.ID)
-	}
-
-	// Start processing asynchronously
-	ctx := context.Background()
-	go h.jobProcessor.ProcessImportJob(ctx, job.ID, filePath, format)
-
-	c.JSON(http.StatusAccepted, gin.H{
-		"job_id":  job.ID,
-		"status":  job.Status,
-		"message": "Import job created successfully",
-	})
-}
-
-// GetImportJob retrieves the status of an import job
-func (h *Handler) GetImportJob(c *gin.Context) {
-	jobID := c.Param("job_id")
-
-	job, exists := h.jobManager.GetImportJob(jobID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, job)
-}
-
-// StreamExport handles streaming export requests
-func (h *Handler) StreamExport(c *gin.Context) {
-	resourceType := c.Query("resource")
-	format := c.DefaultQuery("format", "ndjson")
-
-	// Validate parameters
-	if resourceType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "resource parameter is required"})
-		return
-	}
-
-	if !h.isValidResourceFormat(resourceType, format) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", format, resourceType),
-		})
-		return
-	}
-
-	// Parse filters from query parameters
-	filters := make(map[string]string)
-	for key, values := range c.Request.URL.Query() {
-		if key != "resource" && key != "format" && len(values) > 0 {
-			filters[key] = values[0]
-		}
-	}
-
-	// Stream the export
-	err := h.streamProcessor.StreamExport(c.Writer, resourceType, format, filters)
-	if err != nil {
-		// If headers haven't been written yet, we can still return a JSON error
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Export failed: %v", err)})
-		return
-	}
-}
-
-// CreateExportJob creates a new asynchronous export job
-func (h *Handler) CreateExportJob(c *gin.Context) {
-	var req models.ExportRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validate resource type and format
-	if !h.isValidResourceFormat(req.ResourceType, req.Format) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", req.Format, req.ResourceType),
-		})
-		return
-	}
-
-	// Create export job
-	job := h.jobManager.CreateExportJob(req.ResourceType, req.Format, req.Filters)
-
-	// Start processing asynchronously
-	ctx := context.Background()
-	go h.jobProcessor.ProcessExportJob(ctx, job.ID)
-
-	c.JSON(http.StatusAccepted, gin.H{
-		"job_id":  job.ID,
-		"status":  job.Status,
-		"message": "Export job created successfully",
-	})
-}
-
-// GetExportJob retrieves the status of an export job
-func (h *Handler) GetExportJob(c *gin.Context) {
-	jobID := c.Param("job_id")
-
-	job, exists := h.jobManager.GetExportJob(jobID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, job)
-}
-
-// DownloadExportFile serves export files for download
-func (h *Handler) DownloadExportFile(c *gin.Context) {
-	fileName := c.Param("filename")
-	filePath := filepath.Join(h.exportDir, fileName)
-
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
-	}
-
-	// Serve the file
-	c.File(filePath)
-}
-
-// GetJobStats returns statistics about jobs
-func (h *Handler) GetJobStats(c *gin.Context) {
-	stats := h.jobManager.GetJobStats()
-	c.JSON(http.StatusOK, stats)
-}
-
-// HealthCheck endpoint
-func (h *Handler) HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"timestamp": time.Now().UTC(),
-		"version":   "1.0.0",
-	})
-}
-
-// downloadFile downloads a file from URL and saves it locally
-func (h *Handler) downloadFile(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download file: HTTP %d", resp.StatusCode)
-	}
-
-	// Check content length
-	if resp.ContentLength > h.maxFileSize {
-		return "", fmt.Errorf("file size exceeds maximum allowed size")
-	}
-
-	// Create local file
-	fileName := fmt.Sprintf("download_%d", time.Now().Unix())
-	filePath := filepath.Join(h.uploadsDir, fileName)
-
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer dst.Close()
-
-	// Copy with size limit
-	_, err = io.CopyN(dst, resp.Body, h.maxFileSize)
-	if err != nil && err != io.EOF {
-		return "", err
-	}
-
-	return filePath, nil
-}
-
-// isValidResourceFormat validates resource type and format combinations
-func (h *Handler) isValidResourceFormat(resourceType, format string) bool {
-	validCombinations := map[string][]string{
-		"users":    {"csv", "ndjson", "json"},
-		"articles": {"ndjson", "json"},
-		"comments": {"ndjson", "json"},
-	}
-
-	formats, exists := validCombinations[resourceType]
-	if !exists {
-		return false
-	}
-
-	for _, validFormat := range formats {
-		if format == validFormat {
-			return true
-		}
-	}
-
-	return false
-}
-
-// Middleware for request logging
-func (h *Handler) RequestLogger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-
-		// Process request
-		c.Next()
-
-		// Log request details
-		latency := time.Since(start)
-		status := c.Writer.Status()
-
-		fmt.Printf("[%s] %s %s %d %v\n",
-			start.Format(time.RFC3339),
-			c.Request.Method,
-			c.Request.URL.Path,
-			status,
-			latency,
-		)
-	}
-}
-
-// Middleware for CORS
-func (h *Handler) CORS() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, Idempotency-Key")
-		c.Header("Access-Control-Expose-Headers", "Content-Length")
-		c.Header("Access-Control-Allow-Credentials", "true")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	}
-}
-
-// Middleware for rate limiting (simple in-memory implementation)
-func (h *Handler) RateLimit() gin.HandlerFunc {
-	// This is a simple implementation. In production, use a proper rate limiting library
-	requests := make(map[string][]time.Time)
-
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		now := time.Now()
-
-		// Clean old requests (older than 1 minute)
-		if times, exists := requests[clientIP]; exists {
-			var recent []time.Time
-			for _, t := range times {
-				if now.Sub(t) < time.Minute {
-					recent = append(recent, t)
-				}
-			}
-			requests[clientIP] = recent
-		}
-
-		// Check rate limit (max 100 requests per minute)
-		if len(requests[clientIP]) >= 100 {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Rate limit exceeded",
-				"retry_after": 60,
-			})
-			c.Abort()
-			return
-		}
-
-		// Add current request
-		requests[clientIP] = append(requests[clientIP], now)
-		c.Next()
-	}
-}
-
-// Middleware for request size limiting
-func (h *Handler) RequestSizeLimit() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if c.Request.ContentLength > h.maxFileSize {
-			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-				"error":    "Request body too large",
-				"max_size": h.maxFileSize,
-			})
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/digest"
+	"github.com/vairarchi/bulk-import-export-api/pkg/fetch"
+	"github.com/vairarchi/bulk-import-export-api/pkg/jobs"
+	"github.com/vairarchi/bulk-import-export-api/pkg/s3"
+	"github.com/vairarchi/bulk-import-export-api/pkg/streaming"
+	"github.com/vairarchi/bulk-import-export-api/pkg/webhooks"
+)
+
+// queueRetryAfterSeconds is the Retry-After hint sent when a job queue is full
+const queueRetryAfterSeconds = 30
+
+// sha256Checksum matches the checksum that completes a chunked upload
+var sha256Checksum = regexp.MustCompile(`^(sha256:)?[0-9a-fA-F]{64}$`)
+
+// mappingProfileName matches the names a mapping profile may be saved under
+var mappingProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// eventKeepAliveInterval is how often an idle event stream sends a comment line
+// so proxies don't close the connection
+const eventKeepAliveInterval = 15 * time.Second
+
+// Handler handles HTTP requests for import/export operations
+type Handler struct {
+	jobManager      *jobs.JobManager
+	jobProcessor    *jobs.JobProcessor
+	streamProcessor *streaming.Processor
+	idempotencyMgr  *jobs.IdempotencyManager
+	profileMgr      *jobs.ProfileManager
+	uploadMgr       *jobs.UploadManager
+	notifier        *webhooks.Notifier
+	fetcher         *fetch.Fetcher
+	uploadsDir      string
+	exportDir       string
+	maxFileSize     int64
+	spoolThreshold  int64 // bytes of a streamed import kept in memory before it is spooled
+	maxStreamSize   int64 // largest body a streamed import may send
+	callbackSecrets bool  // whether jobs may have callback secrets of their own, which are stored sealed
+}
+
+// NewHandler creates a new HTTP handler
+func NewHandler(
+	jobManager *jobs.JobManager,
+	jobProcessor *jobs.JobProcessor,
+	streamProcessor *streaming.Processor,
+	idempotencyMgr *jobs.IdempotencyManager,
+	profileMgr *jobs.ProfileManager,
+	uploadMgr *jobs.UploadManager,
+	notifier *webhooks.Notifier,
+	fetcher *fetch.Fetcher,
+	uploadsDir, exportDir string,
+) *Handler {
+	return &Handler{
+		jobManager:      jobManager,
+		jobProcessor:    jobProcessor,
+		streamProcessor: streamProcessor,
+		idempotencyMgr:  idempotencyMgr,
+		profileMgr:      profileMgr,
+		uploadMgr:       uploadMgr,
+		notifier:        notifier,
+		fetcher:         fetcher,
+		uploadsDir:      uploadsDir,
+		exportDir:       exportDir,
+		maxFileSize:     100 * 1024 * 1024, // 100MB max file size
+		spoolThreshold:  streaming.DefaultSpoolThreshold,
+		maxStreamSize:   jobs.DefaultMaxUploadSize,
+	}
+}
+
+// SetStreamLimits sets how much of a streamed import is kept in memory before
+// it is spooled to disk, and how large its body may be
+func (h *Handler) SetStreamLimits(spoolThreshold, maxSize int64) {
+	h.spoolThreshold = spoolThreshold
+	h.maxStreamSize = maxSize
+}
+
+// SetCallbackSecrets sets whether jobs may have callback secrets of their
+// own. They are only stored sealed, so this needs a key to seal them with.
+func (h *Handler) SetCallbackSecrets(enabled bool) {
+	h.callbackSecrets = enabled
+}
+
+// CreateImportJob creates a new import job
+func (h *Handler) CreateImportJob(c *gin.Context) {
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+
+	// A streamed import runs as it arrives, in a stream slot rather than the queue
+	if format := streamedImportFormat(c); format != "" {
+		h.createStreamImport(c, idempotencyKey, format)
+		return
+	}
+
+	// Reject early, before accepting the upload, if no worker slot is available
+	if h.jobProcessor.ImportQueueFull() {
+		h.respondQueueFull(c, "import")
+		return
+	}
+
+	// Content-Digest and Content-MD5 describe the request body, so a multipart
+	// body is hashed as the form is parsed
+	bodyDigests, err := digest.FromHeader(c.Request.Header)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var bodyVerifier *digest.Verifier
+	if len(bodyDigests) > 0 && c.ContentType() == "multipart/form-data" {
+		bodyVerifier = digest.NewVerifier(bodyDigests...)
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(c.Request.Body, bodyVerifier), c.Request.Body}
+	}
+
+	// Reject an invalid callback before accepting the upload
+	if err := h.validateCallback(c.PostForm("callback_url"), c.PostForm("callback_secret")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var filePath string
+	var format string
+	var resourceType string
+	var callbackURL, callbackSecret string
+	var options models.ImportOptions
+	var fingerprint string
+	var sourceDigest string          // sha256 of the file as received, when known before the job starts
+	var upload *models.UploadSession // set when the file comes from a claimed upload session
+	var source *models.RemoteSource  // set when the job downloads a file_url itself
+
+	// Check content type for multipart upload
+	contentType := c.GetHeader("Content-Type")
+	if contentType != "" && strings.HasPrefix(contentType, "multipart/form-data") {
+		// Handle multipart file upload
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from request"})
+			return
+		}
+		defer file.Close()
+
+		// The form has been parsed, so all that is left of the body is any epilogue
+		if bodyVerifier != nil {
+			io.Copy(io.Discard, c.Request.Body)
+			if err := bodyVerifier.Verify(); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Request body does not match its Content-Digest or Content-MD5"})
+				return
+			}
+		}
+
+		// Validate file size
+		if header.Size > h.maxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds maximum allowed size"})
+			return
+		}
+
+		// Get additional form parameters
+		resourceType = c.PostForm("resource_type")
+		format = c.PostForm("format")
+		callbackURL = c.PostForm("callback_url")
+		callbackSecret = c.PostForm("callback_secret")
+
+		if options, err = importOptionsFrom(c.PostForm); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Validate required parameters
+		if resourceType == "" || format == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resource_type and format are required"})
+			return
+		}
+		// Validate resource type and format combination before the file is saved
+		if !streaming.SupportsImport(resourceType, format) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", format, resourceType),
+			})
+			return
+		}
+		if err := h.prepareImportOptions(resourceType, format, &options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var fileDigests []digest.Digest
+		if value := c.PostForm("sha256"); value != "" {
+			expected, err := digest.ParseSHA256(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			fileDigests = append(fileDigests, expected)
+		}
+
+		// Save uploaded file, hashing it to check it and fingerprint the request.
+		// Each upload gets a file of its own, as a failed job keeps it to be resumed.
+		dst, err := os.CreateTemp(h.uploadsDir, "*_"+strings.ReplaceAll(header.Filename, "*", "_"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
+			return
+		}
+		defer dst.Close()
+		filePath = dst.Name()
+
+		verifier := digest.NewVerifier(fileDigests...)
+		_, err = io.Copy(io.MultiWriter(dst, verifier), file)
+		if err != nil {
+			os.Remove(filePath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
+			return
+		}
+		if err := verifier.Verify(); err != nil {
+			os.Remove(filePath)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": fmt.Sprintf("Uploaded file does not match its sha256; received %s", verifier.SHA256()),
+			})
+			return
+		}
+		sourceDigest = verifier.SHA256()
+
+		fingerprint = jobs.RequestFingerprint(resourceType, format, importOptionsFingerprint(options), sourceDigest)
+		if h.respondIdempotent(c, "imports", idempotencyKey, fingerprint) {
+			os.Remove(filePath)
+			return
+		}
+	} else {
+		// Handle JSON request with file URL
+		var req models.ImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resourceType = req.ResourceType
+		format = req.Format
+		callbackURL = req.CallbackURL
+		callbackSecret = req.CallbackSecret
+		options = req.ImportOptions
+
+		// Validate resource type and format combination before a file is reserved
+		if !streaming.SupportsImport(resourceType, format) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", format, resourceType),
+			})
+			return
+		}
+		if err := h.validateCallback(callbackURL, callbackSecret); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := h.prepareImportOptions(resourceType, format, &options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The file is downloaded from a URL or taken from a completed upload session
+		if (req.FileURL == "") == (req.UploadID == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "either file_url or upload_id is required for JSON requests"})
+			return
+		}
+		if s3.IsURL(req.FileURL) {
+			// An object in S3 is read in place by the job, so there is nothing to download
+			if err := checkObjectSource(req.FileURL, req.FileHeaders, req.FileCredential, req.FileChecksum); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if resourceType == "bundle" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "bundles can't be imported from s3:// URLs"})
+				return
+			}
+		} else if req.FileURL != "" {
+			source = &models.RemoteSource{
+				URL:        req.FileURL,
+				Headers:    req.FileHeaders,
+				Credential: req.FileCredential,
+				Checksum:   req.FileChecksum,
+			}
+			download := fetch.Request{URL: source.URL, Headers: source.Headers, Credential: source.Credential, Checksum: source.Checksum}
+			if err := h.fetcher.ValidateRequest(download); err != nil {
+				respondSourceError(c, err)
+				return
+			}
+		}
+
+		// A retry is answered before another job is started for the file
+		sourceKey := "url:" + req.FileURL
+		if req.UploadID != "" {
+			sourceKey = "upload:" + req.UploadID
+		}
+		fingerprint = jobs.RequestFingerprint(resourceType, format, importOptionsFingerprint(options), sourceKey)
+		if h.respondIdempotent(c, "imports", idempotencyKey, fingerprint) {
+			return
+		}
+
+		if req.UploadID != "" {
+			// Claimed at once, so no concurrent import can take the same file
+			session, err := h.uploadMgr.ClaimUpload(req.UploadID)
+			if err != nil {
+				respondUploadError(c, session, err)
+				return
+			}
+			filePath, upload = session.FilePath, session
+			sourceDigest = "sha256:" + session.Checksum
+		} else if s3.IsURL(req.FileURL) {
+			if err := h.streamProcessor.CheckImportObject(c.Request.Context(), req.FileURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filePath = req.FileURL
+		} else {
+			// The job downloads the file in the background, so the request doesn't wait for it
+			var err error
+			if filePath, err = h.reserveDownloadFile(req.FileURL); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file for download"})
+				return
+			}
+		}
+	}
+
+	// Check the mapping against the file before the job starts; a downloaded
+	// file is checked by the job once it has arrived
+	var warnings []string
+	if source == nil {
+		var err error
+		if warnings, err = h.streamProcessor.CheckMapping(c.Request.Context(), filePath, resourceType, format, options); err != nil {
+			// An uploaded file goes back to its session for another try, and an S3 object is not ours
+			if upload != nil {
+				h.uploadMgr.ReturnUpload(upload)
+			} else if !s3.IsURL(filePath) {
+				os.Remove(filePath)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Create import job
+	job := h.jobManager.CreateImportJob(resourceType, format, filePath)
+	if source != nil {
+		h.jobManager.SetImportSource(job.ID, *source)
+	}
+	if sourceDigest != "" {
+		h.jobManager.SetImportSourceDigest(job.ID, sourceDigest)
+	}
+	if callbackURL != "" {
+		h.jobManager.SetImportCallback(job.ID, callbackURL, callbackSecret)
+	}
+	h.jobManager.SetImportOptions(job.ID, options)
+	h.jobManager.AddImportWarnings(job.ID, warnings...)
+
+	// Set idempotency mapping if provided
+	if idempotencyKey != "" {
+		h.idempotencyMgr.SetIdempotency("imports", idempotencyKey, fingerprint, job.ID)
+	}
+
+	// Queue the job; it stays pending until a worker picks it up
+	if err := h.jobProcessor.EnqueueImportJob(job.ID); err != nil {
+		h.jobManager.UpdateImportJob(job.ID, "failed", 100, 0, 0, 0, []models.ValidationError{{
+			Row:     0,
+			Field:   "general",
+			Message: fmt.Sprintf("Import not started: %v", err),
+		}})
+		h.respondQueueFull(c, "import")
+		return
+	}
+
+	response := gin.H{
+		"job_id":  job.ID,
+		"status":  job.Status,
+		"dry_run": options.DryRun,
+		"message": "Import job created successfully",
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// createStreamImport imports the records sent as the request body, feeding
+// the body to the import as it arrives instead of saving it first. A body
+// that ends within the spool threshold is answered with the summary of the
+// finished job. Past the threshold the body is spooled to disk, and the
+// request is answered with 202 once all of it has arrived while the job
+// carries on.
+func (h *Handler) createStreamImport(c *gin.Context, idempotencyKey, contentFormat string) {
+	resourceType := c.Query("resource")
+	format := c.DefaultQuery("format", contentFormat)
+	if format != contentFormat {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("format '%s' doesn't match Content-Type %s", format, c.ContentType()),
+		})
+		return
+	}
+	if resourceType == "bundle" || !streaming.SupportsImport(resourceType, format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", format, resourceType),
+		})
+		return
+	}
+	callbackURL := c.Query("callback_url")
+	if err := h.validateCallbackURL(callbackURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	options, err := importOptionsFrom(c.Query)
+	if err == nil {
+		err = h.prepareImportOptions(resourceType, format, &options)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The records are imported as they arrive, before a digest of the body could be checked
+	if c.GetHeader("Content-Digest") != "" || c.GetHeader("Content-MD5") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Content-Digest and Content-MD5 can't be checked before a streamed import runs; upload the file instead",
+		})
+		return
+	}
+
+	if c.Request.ContentLength > h.maxStreamSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large", "max_size": h.maxStreamSize})
+		return
+	}
+	body := io.Reader(http.MaxBytesReader(c.Writer, c.Request.Body, h.maxStreamSize))
+	size := max(c.Request.ContentLength, 0)
+	switch c.GetHeader("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		decompressed, err := gzip.NewReader(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read gzip body"})
+			return
+		}
+		defer decompressed.Close()
+		body, size = decompressed, 0 // progress can't be told from the compressed length
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Encoding must be gzip or identity"})
+		return
+	}
+	// The digest is taken after decoding, so it matches the spool file a resumed job reads
+	received := &digestedBody{reader: body, verifier: digest.NewVerifier()}
+
+	// The body can't be hashed before it is imported, so a retry is matched on its parameters
+	fingerprint := jobs.RequestFingerprint(resourceType, format, importOptionsFingerprint(options), "stream")
+	if h.respondIdempotent(c, "imports", idempotencyKey, fingerprint) {
+		return
+	}
+	release, ok := h.jobProcessor.AcquireImportStreamSlot()
+	if !ok {
+		h.respondQueueFull(c, "import")
+		return
+	}
+
+	job := h.jobManager.CreateImportJob(resourceType, format, "")
+	received.onEnd = func(sourceDigest string) {
+		h.jobManager.SetImportSourceDigest(job.ID, sourceDigest)
+	}
+	if callbackURL != "" {
+		h.jobManager.SetImportCallback(job.ID, callbackURL, "")
+	}
+	h.jobManager.SetImportOptions(job.ID, options)
+	if idempotencyKey != "" {
+		h.idempotencyMgr.SetIdempotency("imports", idempotencyKey, fingerprint, job.ID)
+	}
+
+	// The job outlives the request once the body has been spooled
+	stream := streaming.NewImportStream(received, h.spoolThreshold, h.uploadsDir)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer release()
+		defer stream.Close()
+		h.jobProcessor.ProcessImportStream(context.Background(), job.ID, stream, size)
+	}()
+
+	select {
+	case <-done:
+		finished, _ := h.jobManager.GetImportJob(job.ID)
+		c.JSON(http.StatusOK, finished.Summary())
+	case <-stream.Spilled():
+		err := stream.Drain(func(path string) {
+			h.jobManager.SetImportFilePath(job.ID, path) // the job can be resumed from the spool file
+		})
+		if err != nil {
+			<-done // the job fails on the same error
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"job_id": job.ID, "error": "Request body too large", "max_size": h.maxStreamSize})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"job_id": job.ID, "error": fmt.Sprintf("Failed to read request body: %v", err)})
+			return
+		}
+		current, _ := h.jobManager.GetImportJob(job.ID)
+		c.JSON(http.StatusAccepted, gin.H{
+			"job_id":  job.ID,
+			"status":  current.Status,
+			"message": "Request body received; the import continues in the background",
+		})
+	}
+}
+
+// digestedBody hashes the decoded body of a streamed import as it is read, and
+// records its digest once it has been read to the end, which is before the
+// import can complete
+type digestedBody struct {
+	reader   io.Reader
+	verifier *digest.Verifier
+	onEnd    func(sourceDigest string)
+}
+
+func (b *digestedBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	b.verifier.Write(p[:n])
+	if err == io.EOF && b.onEnd != nil {
+		b.onEnd(b.verifier.SHA256())
+		b.onEnd = nil
+	}
+	return n, err
+}
+
+// streamedFormats maps the content types an import may be streamed as to its format
+var streamedFormats = map[string]string{
+	"application/x-ndjson": "ndjson",
+	"text/csv":             "csv",
+}
+
+// streamedImportFormat returns the format of a request that streams the
+// records of an import as its body, or "" for any other request
+func streamedImportFormat(c *gin.Context) string {
+	if c.Request.Method != http.MethodPost || c.FullPath() != "/v1/imports" {
+		return ""
+	}
+	return streamedFormats[c.ContentType()]
+}
+
+// PreviewImport detects the format, delimiter and encoding of an import file,
+// suggests a column mapping and validates its first rows. No job is created
+// and the file is discarded afterwards.
+func (h *Handler) PreviewImport(c *gin.Context) {
+	var req models.ImportPreviewRequest
+	var upload io.Reader
+	var fileName string
+
+	contentType := c.GetHeader("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from request"})
+			return
+		}
+		defer file.Close()
+
+		if header.Size > h.maxFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds maximum allowed size"})
+			return
+		}
+
+		req.ResourceType = c.PostForm("resource_type")
+		req.Format = c.PostForm("format")
+		if rows := c.PostForm("rows"); rows != "" {
+			if req.Rows, err = strconv.Atoi(rows); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "rows must be a number"})
+				return
+			}
+		}
+		if req.ImportOptions, err = importOptionsFrom(c.PostForm); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		upload, fileName = file, header.Filename
+	} else {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.FileURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file_url is required for JSON requests"})
+			return
+		}
+	}
+	download := fetch.Request{
+		URL:        req.FileURL,
+		Headers:    req.FileHeaders,
+		Credential: req.FileCredential,
+		MaxSize:    h.maxFileSize,
+	}
+	objectURL := upload == nil && s3.IsURL(req.FileURL) // an S3 object is previewed in place
+	if objectURL {
+		if err := checkObjectSource(req.FileURL, req.FileHeaders, req.FileCredential, ""); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if upload == nil {
+		if err := h.fetcher.ValidateRequest(download); err != nil {
+			respondSourceError(c, err)
+			return
+		}
+	}
+
+	if req.ResourceType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource_type is required"})
+		return
+	}
+	if !streaming.SupportsPreview(req.ResourceType, req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Cannot preview format '%s' for resource type '%s'", req.Format, req.ResourceType),
+		})
+		return
+	}
+	if req.Rows < 0 || req.Rows > streaming.MaxPreviewRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rows must be between 1 and %d", streaming.MaxPreviewRows)})
+		return
+	}
+	if err := h.prepareImportOptions(req.ResourceType, req.Format, &req.ImportOptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The file is only kept while it is previewed
+	var filePath string
+	if upload != nil {
+		dst, err := os.CreateTemp(h.uploadsDir, "preview_*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
+			return
+		}
+		filePath = dst.Name()
+		_, err = io.Copy(dst, upload)
+		dst.Close()
+		if err != nil {
+			os.Remove(filePath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
+			return
+		}
+	} else if objectURL {
+		filePath, fileName = req.FileURL, path.Base(req.FileURL)
+	} else {
+		var err error
+		if filePath, err = h.downloadFile(c.Request.Context(), download); err != nil {
+			respondDownloadError(c, err)
+			return
+		}
+		fileName = filepath.Base(filePath)
+	}
+	if !objectURL {
+		defer os.Remove(filePath)
+	}
+
+	preview, err := h.streamProcessor.PreviewImport(c.Request.Context(), filePath, fileName, req.ResourceType, req.Format, req.ImportOptions, req.Rows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// importOptionsFrom reads the import options of a multipart upload, or the
+// query of a streamed import, from the parameter lookup get
+func importOptionsFrom(get func(key string) string) (models.ImportOptions, error) {
+	options := models.ImportOptions{
+		Delimiter:      get("delimiter"),
+		Comment:        get("comment"),
+		Charset:        get("charset"),
+		MappingProfile: get("mapping_profile"),
+	}
+
+	if mapping := get("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &options.Mapping); err != nil {
+			return options, fmt.Errorf("mapping must be a JSON object of source columns to fields")
+		}
+	}
+	if transforms := get("transforms"); transforms != "" {
+		if err := json.Unmarshal([]byte(transforms), &options.Transforms); err != nil {
+			return options, fmt.Errorf("transforms must be a JSON object of fields to lists of steps")
+		}
+	}
+
+	flags := []struct {
+		name  string
+		value *bool
+	}{
+		{"dry_run", &options.DryRun},
+		{"lazy_quotes", &options.LazyQuotes},
+		{"no_header", &options.NoHeader},
+		{"keep_bom", &options.KeepBOM},
+	}
+	for _, flag := range flags {
+		raw := get(flag.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return options, fmt.Errorf("%s must be true or false", flag.name)
+		}
+		*flag.value = value
+	}
+	return options, nil
+}
+
+// prepareImportOptions validates the options of an import, taking its column
+// mapping from the saved profile it names, if any
+func (h *Handler) prepareImportOptions(resourceType, format string, options *models.ImportOptions) error {
+	if err := streaming.ValidateImportOptions(*options); err != nil {
+		return err
+	}
+	if options.MappingProfile != "" {
+		if len(options.Mapping) > 0 {
+			return fmt.Errorf("give either mapping or mapping_profile, not both")
+		}
+		profile, exists := h.profileMgr.GetProfile(options.MappingProfile)
+		if !exists {
+			return fmt.Errorf("mapping profile %q not found", options.MappingProfile)
+		}
+		if profile.ResourceType != resourceType {
+			return fmt.Errorf("mapping profile %q is for %s, not %s", profile.Name, profile.ResourceType, resourceType)
+		}
+		options.Mapping = profile.Mapping
+	}
+	if err := streaming.ValidateMapping(resourceType, format, options.Mapping, options.NoHeader); err != nil {
+		return err
+	}
+	return streaming.ValidateTransforms(resourceType, options.Transforms)
+}
+
+// importOptionsFingerprint identifies the options of an import request, for
+// comparing a retry with the original
+func importOptionsFingerprint(options models.ImportOptions) string {
+	encoded, _ := json.Marshal(options)
+	return string(encoded)
+}
+
+// GetImportJob retrieves the status of an import job
+func (h *Handler) GetImportJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, exists := h.jobManager.GetImportJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	if job.Status == "pending" {
+		job.QueuePosition = h.jobProcessor.ImportQueuePosition(jobID)
+	}
+	if job.ErrorRecords > 0 {
+		job.ErrorReportURL = fmt.Sprintf("/v1/imports/%s/errors", jobID)
+	}
+	if job.ResourceType == "bundle" {
+		job.Children = h.jobManager.ImportJobChildren(jobID)
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// GetImportErrors downloads every validation error of an import job as CSV or NDJSON
+func (h *Handler) GetImportErrors(c *gin.Context) {
+	jobID := c.Param("job_id")
+	format := c.DefaultQuery("format", "ndjson")
+
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+	if _, exists := h.jobManager.GetImportJob(jobID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s_errors.%s", jobID, format))
+	c.Status(http.StatusOK)
+
+	if err := h.jobManager.WriteImportErrorReport(jobID, format, c.Writer); err != nil {
+		// Headers are already sent, so the truncated report is all the client gets
+		c.Error(err)
+	}
+}
+
+// CancelImportJob cancels a pending or running import job
+func (h *Handler) CancelImportJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := h.jobProcessor.CancelImportJob(jobID)
+	if err != nil {
+		h.respondCancelError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":            job.ID,
+		"status":            job.Status,
+		"committed_batches": job.CommittedBatches,
+		"valid_records":     job.ValidRecords,
+		"message":           "Import job cancelled; committed batches were kept",
+	})
+}
+
+// ResumeImportJob re-queues a failed or cancelled import from its last checkpoint
+func (h *Handler) ResumeImportJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := h.jobProcessor.ResumeImportJob(jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		case errors.Is(err, jobs.ErrJobNotResumable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, jobs.ErrSourceFileMissing):
+			c.JSON(http.StatusGone, gin.H{"error": "The uploaded file for this job is no longer available"})
+		case errors.Is(err, jobs.ErrQueueFull):
+			h.respondQueueFull(c, "import")
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	resumeFrom := 0
+	if job.Checkpoint != nil {
+		resumeFrom = job.Checkpoint.RowNumber
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":      job.ID,
+		"status":      job.Status,
+		"resume_from": resumeFrom,
+		"message":     "Import job resumed from last checkpoint",
+	})
+}
+
+// ListImportJobs lists import jobs with filters and cursor pagination
+func (h *Handler) ListImportJobs(c *gin.Context) {
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summaries, nextCursor, err := h.jobManager.ListImportJobs(opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":        summaries,
+		"count":       len(summaries),
+		"next_cursor": nextCursor,
+	})
+}
+
+// SaveMappingProfile creates or replaces a named column mapping profile
+func (h *Handler) SaveMappingProfile(c *gin.Context) {
+	name := c.Param("name")
+	if !mappingProfileName.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Profile name must be up to 64 letters, digits, '.', '_' or '-'"})
+		return
+	}
+
+	var req models.MappingProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Mapping) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mapping is required"})
+		return
+	}
+	if err := streaming.ValidateMapping(req.ResourceType, "", req.Mapping, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := h.profileMgr.SaveProfile(models.MappingProfile{
+		Name:         name,
+		ResourceType: req.ResourceType,
+		Mapping:      req.Mapping,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// ListMappingProfiles lists the saved column mapping profiles
+func (h *Handler) ListMappingProfiles(c *gin.Context) {
+	profiles := h.profileMgr.ListProfiles()
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": profiles,
+		"count":    len(profiles),
+	})
+}
+
+// GetMappingProfile retrieves a column mapping profile
+func (h *Handler) GetMappingProfile(c *gin.Context) {
+	profile, exists := h.profileMgr.GetProfile(c.Param("name"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mapping profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteMappingProfile removes a column mapping profile
+func (h *Handler) DeleteMappingProfile(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := h.profileMgr.DeleteProfile(name); err != nil {
+		if errors.Is(err, jobs.ErrProfileNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mapping profile not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":    name,
+		"message": "Mapping profile deleted; jobs created with it keep their mapping",
+	})
+}
+
+// CreateUploadSession starts a chunked upload, for files too large or links
+// too flaky for a single request
+func (h *Handler) CreateUploadSession(c *gin.Context) {
+	var req models.UploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FileName == "" || req.Size <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_name and a positive size are required"})
+		return
+	}
+
+	session, err := h.uploadMgr.CreateSession(req.FileName, req.Size)
+	if err != nil {
+		respondUploadError(c, session, err)
+		return
+	}
+
+	c.Header("Location", "/v1/uploads/"+session.ID)
+	c.JSON(http.StatusCreated, session)
+}
+
+// GetUploadSession reports how many bytes of an upload were received, which
+// is where the next chunk starts
+func (h *Handler) GetUploadSession(c *gin.Context) {
+	session, exists := h.uploadMgr.GetSession(c.Param("upload_id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// UploadChunk appends a chunk to an upload. Its Content-Range header, such as
+// "bytes 0-1048575/2147483648", must start at the received offset.
+func (h *Handler) UploadChunk(c *gin.Context) {
+	id := c.Param("upload_id")
+	start, end, total, err := parseContentRange(c.GetHeader("Content-Range"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	length := end - start + 1
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != length {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Length does not match Content-Range"})
+		return
+	}
+
+	session, exists := h.uploadMgr.GetSession(id)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return
+	}
+	if total >= 0 && total != session.Size {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Content-Range total does not match the upload size of %d bytes", session.Size)})
+		return
+	}
+
+	session, err = h.uploadMgr.WriteChunk(id, start, length, c.Request.Body)
+	if err != nil {
+		respondUploadError(c, session, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// CompleteUpload finishes an upload once every byte arrived, checking it
+// against its sha256 checksum. The session ID can then be given as upload_id
+// when creating an import job.
+func (h *Handler) CompleteUpload(c *gin.Context) {
+	var req models.CompleteUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !sha256Checksum.MatchString(req.Checksum) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "checksum must be a hex encoded sha256, optionally prefixed with 'sha256:'"})
+		return
+	}
+
+	session, err := h.uploadMgr.CompleteSession(c.Param("upload_id"), req.Checksum)
+	if err != nil {
+		respondUploadError(c, session, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// DeleteUploadSession abandons an upload and removes what it received
+func (h *Handler) DeleteUploadSession(c *gin.Context) {
+	id := c.Param("upload_id")
+
+	if err := h.uploadMgr.DeleteSession(id); err != nil {
+		respondUploadError(c, nil, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"message": "Upload session deleted",
+	})
+}
+
+// respondUploadError answers a failed upload request, with the received
+// offset when the client can resume from it
+func respondUploadError(c *gin.Context, session *models.UploadSession, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, jobs.ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return
+	case errors.Is(err, jobs.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, jobs.ErrUploadPastSize):
+		status = http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, jobs.ErrUploadChecksumMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error() + "; the upload was discarded"})
+		return
+	case errors.Is(err, jobs.ErrUploadOffsetMismatch), errors.Is(err, jobs.ErrUploadBusy),
+		errors.Is(err, jobs.ErrUploadCompleted), errors.Is(err, jobs.ErrUploadIncomplete):
+		status = http.StatusConflict
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		status = http.StatusBadRequest
+	}
+
+	response := gin.H{"error": err.Error()}
+	if session != nil {
+		response["received_bytes"] = session.ReceivedBytes
+	}
+	c.JSON(status, response)
+}
+
+// parseContentRange reads a Content-Range header such as "bytes 0-1048575/2147483648".
+// The total is -1 when given as "*".
+func parseContentRange(header string) (start, end, total int64, err error) {
+	invalid := fmt.Errorf("Content-Range must look like 'bytes <start>-<end>/<total>'")
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+	byteRange, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+	first, last, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+		return 0, 0, 0, invalid
+	}
+	if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+		return 0, 0, 0, invalid
+	}
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil || total <= end {
+			return 0, 0, 0, invalid
+		}
+	}
+	return start, end, total, nil
+}
+
+// ListExportJobs lists export jobs with filters and cursor pagination
+func (h *Handler) ListExportJobs(c *gin.Context) {
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summaries, nextCursor, err := h.jobManager.ListExportJobs(opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":        summaries,
+		"count":       len(summaries),
+		"next_cursor": nextCursor,
+	})
+}
+
+// parseListOptions reads job listing filters from the query string
+func parseListOptions(c *gin.Context) (jobs.ListOptions, error) {
+	opts := jobs.ListOptions{
+		Status:       c.Query("status"),
+		ResourceType: c.Query("resource_type"),
+		FileName:     c.Query("file_name"),
+		Sort:         c.Query("sort"),
+		Cursor:       c.Query("cursor"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return opts, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.Limit = value
+	}
+
+	for param, target := range map[string]**time.Time{
+		"created_after":  &opts.CreatedAfter,
+		"created_before": &opts.CreatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be an RFC3339 timestamp", param)
+		}
+		*target = &parsed
+	}
+
+	return opts, nil
+}
+
+// StreamExport handles streaming export requests. Without a resource
+// parameter it lists export jobs instead.
+func (h *Handler) StreamExport(c *gin.Context) {
+	resourceType := c.Query("resource")
+	format := c.DefaultQuery("format", "ndjson")
+
+	// Validate parameters
+	if resourceType == "" {
+		h.ListExportJobs(c)
+		return
+	}
+
+	if !streaming.SupportsExport(resourceType, format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", format, resourceType),
+		})
+		return
+	}
+
+	// Parse filters from query parameters
+	filters := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if key != "resource" && key != "format" && len(values) > 0 {
+			filters[key] = values[0]
+		}
+	}
+
+	// Stream the export
+	err := h.streamProcessor.StreamExport(c.Writer, resourceType, format, filters)
+	if err != nil {
+		// If headers haven't been written yet, we can still return a JSON error
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Export failed: %v", err)})
+		return
+	}
+}
+
+// CreateExportJob creates a new asynchronous export job
+func (h *Handler) CreateExportJob(c *gin.Context) {
+	var req models.ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate resource type and format
+	if !streaming.SupportsExport(req.ResourceType, req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid format '%s' for resource type '%s'", req.Format, req.ResourceType),
+		})
+		return
+	}
+
+	if err := h.validateCallback(req.CallbackURL, req.CallbackSecret); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.streamProcessor.CheckExportDestination(req.Destination); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	fingerprint := exportFingerprint(&req)
+	if h.respondIdempotent(c, "exports", idempotencyKey, fingerprint) {
+		return
+	}
+
+	if h.jobProcessor.ExportQueueFull() {
+		h.respondQueueFull(c, "export")
+		return
+	}
+
+	// Create export job
+	job := h.jobManager.CreateExportJob(req.ResourceType, req.Format, req.Filters)
+	if req.CallbackURL != "" {
+		h.jobManager.SetExportCallback(job.ID, req.CallbackURL, req.CallbackSecret)
+	}
+	if req.Destination != "" {
+		h.jobManager.SetExportDestination(job.ID, req.Destination)
+	}
+	if idempotencyKey != "" {
+		h.idempotencyMgr.SetIdempotency("exports", idempotencyKey, fingerprint, job.ID)
+	}
+
+	// Queue the job; it stays pending until a worker picks it up
+	if err := h.jobProcessor.EnqueueExportJob(job.ID); err != nil {
+		h.jobManager.UpdateExportJob(job.ID, "failed", 100, 0, "")
+		h.respondQueueFull(c, "export")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":  job.ID,
+		"status":  job.Status,
+		"message": "Export job created successfully",
+	})
+}
+
+// exportFingerprint identifies an export request by what it exports
+func exportFingerprint(req *models.ExportRequest) string {
+	filters := make([]string, 0, len(req.Filters))
+	for name, value := range req.Filters {
+		filters = append(filters, name+"="+value)
+	}
+	sort.Strings(filters)
+
+	parts := []string{req.ResourceType, req.Format, strings.Join(filters, "&"), strings.Join(req.Fields, ",")}
+	if req.Destination != "" {
+		// Only when set, so keys stored before destinations existed still match
+		parts = append(parts, req.Destination)
+	}
+	return jobs.RequestFingerprint(parts...)
+}
+
+// respondIdempotent answers a request whose Idempotency-Key was already used
+// in scope: with the original job when the request matches, or with 422 when
+// it differs. It returns false when the request should go ahead.
+func (h *Handler) respondIdempotent(c *gin.Context, scope, key, fingerprint string) bool {
+	if key == "" {
+		return false
+	}
+
+	jobID, exists, err := h.idempotencyMgr.CheckIdempotency(scope, key, fingerprint)
+	if errors.Is(err, jobs.ErrIdempotencyKeyReused) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key was already used with a different request",
+		})
+		return true
+	}
+	if !exists {
+		return false
+	}
+
+	var status string
+	if scope == "imports" {
+		job, found := h.jobManager.GetImportJob(jobID)
+		if !found {
+			return false
+		}
+		status = job.Status
+	} else {
+		job, found := h.jobManager.GetExportJob(jobID)
+		if !found {
+			return false
+		}
+		status = job.Status
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":  jobID,
+		"status":  status,
+		"message": "Job already exists for this idempotency key",
+	})
+	return true
+}
+
+// GetExportJob retrieves the status of an export job
+func (h *Handler) GetExportJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, exists := h.jobManager.GetExportJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	if job.Status == "pending" {
+		job.QueuePosition = h.jobProcessor.ExportQueuePosition(jobID)
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelExportJob cancels a pending or running export job and discards its partial file
+func (h *Handler) CancelExportJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := h.jobProcessor.CancelExportJob(jobID)
+	if err != nil {
+		h.respondCancelError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":  job.ID,
+		"status":  job.Status,
+		"message": "Export job cancelled",
+	})
+}
+
+// DownloadExportFile serves export files for download
+func (h *Handler) DownloadExportFile(c *gin.Context) {
+	fileName := c.Param("filename")
+	filePath := filepath.Join(h.exportDir, fileName)
+
+	// Check if file exists
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// Serve the file
+	c.File(filePath)
+}
+
+// GetJobStats returns statistics about jobs
+func (h *Handler) GetJobStats(c *gin.Context) {
+	stats := h.jobManager.GetJobStats()
+	c.JSON(http.StatusOK, stats)
+}
+
+// HealthCheck endpoint
+func (h *Handler) HealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "healthy",
+		"timestamp": time.Now().UTC(),
+		"version":   "1.0.0",
+	})
+}
+
+// GetImportDeliveries returns the webhook delivery log of an import job
+func (h *Handler) GetImportDeliveries(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	if _, exists := h.jobManager.GetImportJob(jobID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":     jobID,
+		"deliveries": h.notifier.Deliveries(jobID),
+	})
+}
+
+// GetExportDeliveries returns the webhook delivery log of an export job
+func (h *Handler) GetExportDeliveries(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	if _, exists := h.jobManager.GetExportJob(jobID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":     jobID,
+		"deliveries": h.notifier.Deliveries(jobID),
+	})
+}
+
+// StreamImportEvents pushes progress, new validation errors and the final
+// status of an import job as Server-Sent Events
+func (h *Handler) StreamImportEvents(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	lastEventID, err := parseLastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	missed, events, unsubscribe, err := h.jobManager.SubscribeImportJob(jobID, lastEventID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	defer unsubscribe()
+
+	current := func() (jobs.JobEvent, bool) {
+		job, exists := h.jobManager.GetImportJob(jobID)
+		if !exists {
+			return jobs.JobEvent{}, false
+		}
+		return jobs.JobEvent{Type: jobs.EventStatus, Data: job.Summary()}, true
+	}
+	h.streamJobEvents(c, missed, events, current)
+}
+
+// StreamExportEvents pushes progress and the final status of an export job as Server-Sent Events
+func (h *Handler) StreamExportEvents(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	lastEventID, err := parseLastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	missed, events, unsubscribe, err := h.jobManager.SubscribeExportJob(jobID, lastEventID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	defer unsubscribe()
+
+	current := func() (jobs.JobEvent, bool) {
+		job, exists := h.jobManager.GetExportJob(jobID)
+		if !exists {
+			return jobs.JobEvent{}, false
+		}
+		return jobs.JobEvent{Type: jobs.EventStatus, Data: job.Summary()}, true
+	}
+	h.streamJobEvents(c, missed, events, current)
+}
+
+// streamJobEvents writes replayed and live job events until the job reaches a
+// final status or the client disconnects. current returns the job's state as
+// a status event; it is sent first so a client always starts from a snapshot.
+func (h *Handler) streamJobEvents(c *gin.Context, missed []jobs.JobEvent, events <-chan jobs.JobEvent, current func() (jobs.JobEvent, bool)) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	write := func(event jobs.JobEvent) {
+		sseEvent := sse.Event{Event: event.Type, Data: event.Data}
+		if event.ID > 0 {
+			sseEvent.Id = strconv.FormatInt(event.ID, 10)
+		}
+		c.Render(-1, sseEvent)
+		c.Writer.Flush()
+	}
+
+	// A reconnecting client only needs what it missed
+	finished := false
+	if len(missed) == 0 {
+		snapshot, exists := current()
+		if !exists {
+			return
+		}
+		write(snapshot)
+		finished = snapshot.IsFinal()
+	}
+	for _, event := range missed {
+		write(event)
+		if event.Type == jobs.EventStatus {
+			finished = event.IsFinal()
+		}
+	}
+	if finished {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		case event, open := <-events:
+			if !open {
+				// Dropped for falling behind; the client reconnects with Last-Event-ID
+				return
+			}
+			write(event)
+			if event.IsFinal() {
+				return
+			}
+		}
+	}
+}
+
+// parseLastEventID reads the ID of the last event a reconnecting client received,
+// from the Last-Event-ID header or the last_event_id query parameter
+func parseLastEventID(c *gin.Context) (int64, error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("last event ID must be a non-negative integer")
+	}
+	return id, nil
+}
+
+// validateCallback checks an optional webhook URL, and a secret of its own
+// that the server must be able to seal to store
+func (h *Handler) validateCallback(rawURL, secret string) error {
+	if secret != "" && !h.callbackSecrets {
+		return fmt.Errorf("callback_secret can't be used, as this server has no key to store it encrypted with")
+	}
+	return h.validateCallbackURL(rawURL)
+}
+
+// validateCallbackURL checks that an optional webhook URL is an absolute http(s)
+// URL that the notifier's policy lets deliveries reach
+func (h *Handler) validateCallbackURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http or https URL")
+	}
+	if reason, blocked := fetch.IsBlocked(h.notifier.CheckURL(rawURL)); blocked {
+		return fmt.Errorf("callback_url is not allowed: %s", reason)
+	}
+	return nil
+}
+
+// respondSourceError answers a file_url, or one of its download options, that
+// is not accepted
+func respondSourceError(c *gin.Context, err error) {
+	if reason, blocked := fetch.IsBlocked(err); blocked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_url is not allowed: " + reason})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// checkObjectSource checks a file_url naming an S3 object. The object is read
+// with the server's own S3 credentials, and S3 checks its integrity, so the
+// options for http downloads don't apply.
+func checkObjectSource(rawURL string, headers map[string]string, credential, checksum string) error {
+	if _, _, err := s3.ParseURL(rawURL); err != nil {
+		return err
+	}
+	if len(headers) > 0 || credential != "" || checksum != "" {
+		return fmt.Errorf("file_headers, file_credential and file_checksum don't apply to s3:// URLs")
+	}
+	return nil
+}
+
+// respondDownloadError answers a failed file_url download, naming the reason
+// when the URL was refused by the fetch policy
+func respondDownloadError(c *gin.Context, err error) {
+	if reason, blocked := fetch.IsBlocked(err); blocked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_url is not allowed: " + reason})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to download file: %v", err)})
+}
+
+// respondCancelError maps job cancellation errors to HTTP responses
+func (h *Handler) respondCancelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, jobs.ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": "Job has already finished and cannot be cancelled"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// respondQueueFull rejects a request because the job queue has no free slot
+func (h *Handler) respondQueueFull(c *gin.Context, kind string) {
+	c.Header("Retry-After", strconv.Itoa(queueRetryAfterSeconds))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":       fmt.Sprintf("The %s queue is full, please retry later", kind),
+		"retry_after": queueRetryAfterSeconds,
+	})
+}
+
+// reserveDownloadFile creates a uniquely named empty file in the uploads
+// directory for a file_url, keeping its extension so a compressed file is
+// recognised
+func (h *Handler) reserveDownloadFile(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(h.uploadsDir, "download_*"+path.Ext(parsed.Path))
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	return file.Name(), nil
+}
+
+// downloadFile downloads a file_url while the request waits, to a uniquely
+// named file in the uploads directory
+func (h *Handler) downloadFile(ctx context.Context, req fetch.Request) (string, error) {
+	filePath, err := h.reserveDownloadFile(req.URL)
+	if err != nil {
+		return "", err
+	}
+	if _, err := h.fetcher.Download(ctx, req, filePath, nil); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+	return filePath, nil
+}
+
+// Middleware for request logging
+func (h *Handler) RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// Process request
+		c.Next()
+
+		// Log request details
+		latency := time.Since(start)
+		status := c.Writer.Status()
+
+		fmt.Printf("[%s] %s %s %d %v\n",
+			start.Format(time.RFC3339),
+			c.Request.Method,
+			c.Request.URL.Path,
+			status,
+			latency,
+		)
+	}
+}
+
+// Middleware for CORS
+func (h *Handler) CORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, Idempotency-Key, Last-Event-ID, Content-Range")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Location")
+		c.Header("Access-Control-Allow-Credentials", "true")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Middleware for rate limiting (simple in-memory implementation)
+func (h *Handler) RateLimit() gin.HandlerFunc {
+	// This is a simple implementation. In production, use a proper rate limiting library
+	requests := make(map[string][]time.Time)
+
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		now := time.Now()
+
+		// Clean old requests (older than 1 minute)
+		if times, exists := requests[clientIP]; exists {
+			var recent []time.Time
+			for _, t := range times {
+				if now.Sub(t) < time.Minute {
+					recent = append(recent, t)
+				}
+			}
+			requests[clientIP] = recent
+		}
+
+		// Check rate limit (max 100 requests per minute)
+		if len(requests[clientIP]) >= 100 {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Rate limit exceeded",
+				"retry_after": 60,
+			})
+			c.Abort()
+			return
+		}
+
+		// Add current request
+		requests[clientIP] = append(requests[clientIP], now)
+		c.Next()
+	}
+}
+
+// Middleware for request size limiting
+func (h *Handler) RequestSizeLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// A streamed import is never held whole, so it has a limit of its own
+		if c.Request.ContentLength > h.maxFileSize && streamedImportFormat(c) == "" {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "Request body too large",
+				"max_size": h.maxFileSize,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
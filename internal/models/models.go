@@ -1,150 +1,444 @@
-package models
-
-import (
-	"time"
-
-	"github.com/google/uuid"
-)
-
-// User represents a user in the system
-type User struct {
-	ID        string    `json:"id" csv:"id" validate:"omitempty,uuid"`
-	Email     string    `json:"email" csv:"email" validate:"required,email"`
-	Name      string    `json:"name" csv:"name" validate:"required"`
-	Role      string    `json:"role" csv:"role" validate:"required,oneof=admin manager reader"`
-	Active    bool      `json:"active" csv:"active"`
-	CreatedAt time.Time `json:"created_at" csv:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" csv:"updated_at"`
-}
-
-// Article represents an article in the system
-type Article struct {
-	ID          string     `json:"id" validate:"omitempty,uuid"`
-	Slug        string     `json:"slug" validate:"required"`
-	Title       string     `json:"title" validate:"required"`
-	Body        string     `json:"body" validate:"required"`
-	AuthorID    string     `json:"author_id" validate:"required,uuid"`
-	Tags        []string   `json:"tags"`
-	PublishedAt *time.Time `json:"published_at,omitempty"`
-	Status      string     `json:"status" validate:"required,oneof=draft published"`
-	CreatedAt   time.Time  `json:"created_at,omitempty"`
-	UpdatedAt   time.Time  `json:"updated_at,omitempty"`
-}
-
-// Comment represents a comment in the system
-type Comment struct {
-	ID        string    `json:"id" validate:"omitempty,uuid"`
-	ArticleID string    `json:"article_id" validate:"required,uuid"`
-	UserID    string    `json:"user_id" validate:"required,uuid"`
-	Body      string    `json:"body" validate:"required"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// ValidationError represents a validation error for a specific record
-type ValidationError struct {
-	Row     int                    `json:"row"`
-	Field   string                 `json:"field"`
-	Value   interface{}            `json:"value"`
-	Message string                 `json:"message"`
-	Record  map[string]interface{} `json:"record,omitempty"`
-}
-
-// ImportJob represents an asynchronous import job
-type ImportJob struct {
-	ID           string            `json:"id"`
-	Status       string            `json:"status"` // pending, processing, completed, failed
-	ResourceType string            `json:"resource_type"`
-	FileName     string            `json:"file_name"`
-	TotalRecords int               `json:"total_records"`
-	ValidRecords int               `json:"valid_records"`
-	ErrorRecords int               `json:"error_records"`
-	Errors       []ValidationError `json:"errors"`
-	CreatedAt    time.Time         `json:"created_at"`
-	CompletedAt  *time.Time        `json:"completed_at,omitempty"`
-	Progress     int               `json:"progress"` // percentage
-}
-
-// ExportJob represents an asynchronous export job
-type ExportJob struct {
-	ID           string            `json:"id"`
-	Status       string            `json:"status"` // pending, processing, completed, failed
-	ResourceType string            `json:"resource_type"`
-	Format       string            `json:"format"`
-	Filters      map[string]string `json:"filters"`
-	TotalRecords int               `json:"total_records"`
-	DownloadURL  string            `json:"download_url,omitempty"`
-	CreatedAt    time.Time         `json:"created_at"`
-	CompletedAt  *time.Time        `json:"completed_at,omitempty"`
-	Progress     int               `json:"progress"` // percentage
-}
-
-// ImportRequest represents a request to import data
-type ImportRequest struct {
-	ResourceType string `json:"resource_type" validate:"required,oneof=users articles comments"`
-	FileURL      string `json:"file_url,omitempty"`
-	Format       string `json:"format" validate:"required,oneof=csv ndjson"`
-}
-
-// ExportRequest represents a request to export data
-type ExportRequest struct {
-	ResourceType string            `json:"resource_type" validate:"required,oneof=users articles comments"`
-	Format       string            `json:"format" validate:"required,oneof=csv ndjson json"`
-	Filters      map[string]string `json:"filters,omitempty"`
-	Fields       []string          `json:"fields,omitempty"`
-}
-
-// GetNaturalKey returns the natural key for upsert operations
-func (u *User) GetNaturalKey() string {
-	return u.Email
-}
-
-// GetNaturalKey returns the natural key for upsert operations
-func (a *Article) GetNaturalKey() string {
-	return a.Slug
-}
-
-// GenerateID generates a new UUID for the record if not set
-func (u *User) GenerateID() {
-	if u.ID == "" {
-		u.ID = uuid.New().String()
-	}
-}
-
-// GenerateID generates a new UUID for the record if not set
-func (a *Article) GenerateID() {
-	if a.ID == "" {
-		a.ID = uuid.New().String()
-	}
-}
-
-// GenerateID generates a new UUID for the record if not set
-func (c *Comment) GenerateID() {
-	if c.ID == "" {
-		c.ID = uuid.New().String()
-	}
-}
-
-// SetTimestamps sets created_at and updated_at for new records
-func (u *User) SetTimestamps() {
-	now := time.Now()
-	if u.CreatedAt.IsZero() {
-		u.CreatedAt = now
-	}
-	u.UpdatedAt = now
-}
-
-// SetTimestamps sets created_at and updated_at for new records
-func (a *Article) SetTimestamps() {
-	now := time.Now()
-	if a.CreatedAt.IsZero() {
-		a.CreatedAt = now
-	}
-	a.UpdatedAt = now
-}
-
-// SetTimestamps sets created_at for new comments
-func (c *Comment) SetTimestamps() {
-	if c.CreatedAt.IsZero() {
-		c.CreatedAt = time.Now()
-	}
-}
+package models
+
+import (
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User represents a user in the system
+type User struct {
+	ID        string    `json:"id" csv:"id" validate:"omitempty,uuid"`
+	Email     string    `json:"email" csv:"email" validate:"required,email"`
+	Name      string    `json:"name" csv:"name" validate:"required"`
+	Role      string    `json:"role" csv:"role" validate:"required,oneof=admin manager reader"`
+	Active    bool      `json:"active" csv:"active"`
+	CreatedAt time.Time `json:"created_at" csv:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" csv:"updated_at"`
+}
+
+// Article represents an article in the system
+type Article struct {
+	ID          string     `json:"id" validate:"omitempty,uuid"`
+	Slug        string     `json:"slug" validate:"required"`
+	Title       string     `json:"title" validate:"required"`
+	Body        string     `json:"body" validate:"required"`
+	AuthorID    string     `json:"author_id" validate:"required,uuid"`
+	Tags        []string   `json:"tags"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	Status      string     `json:"status" validate:"required,oneof=draft published"`
+	CreatedAt   time.Time  `json:"created_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at,omitempty"`
+}
+
+// Comment represents a comment in the system
+type Comment struct {
+	ID        string    `json:"id" validate:"omitempty,uuid"`
+	ArticleID string    `json:"article_id" validate:"required,uuid"`
+	UserID    string    `json:"user_id" validate:"required,uuid"`
+	Body      string    `json:"body" validate:"required"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidationError represents a validation error for a specific record
+type ValidationError struct {
+	Row     int                    `json:"row"`
+	Field   string                 `json:"field"`
+	Value   interface{}            `json:"value"`
+	Message string                 `json:"message"`
+	Record  map[string]interface{} `json:"record,omitempty"`
+}
+
+// ImportJob represents an asynchronous import job
+type ImportJob struct {
+	ID               string             `json:"id"`
+	Status           string             `json:"status"` // pending, downloading, processing, completed, failed, cancelled
+	ResourceType     string             `json:"resource_type"`
+	Format           string             `json:"format"`
+	FileName         string             `json:"file_name"`
+	FilePath         string             `json:"-"`                       // uploaded source, kept until the job completes
+	Source           *RemoteSource      `json:"source,omitempty"`        // file_url the job downloads before processing
+	SourceDigest     string             `json:"source_digest,omitempty"` // "sha256:<hex>" of the source file as received
+	TotalRecords     int                `json:"total_records"`
+	ValidRecords     int                `json:"valid_records"`
+	ErrorRecords     int                `json:"error_records"`              // exact number of errors reported
+	CommittedBatches int                `json:"committed_batches"`          // batches written to the database
+	Errors           []ValidationError  `json:"errors"`                     // first and most recent errors only
+	Warnings         []string           `json:"warnings,omitempty"`         // e.g. source columns that map to no field
+	TransformCounts  []TransformCount   `json:"transform_counts,omitempty"` // values each transform step changed
+	ErrorReportURL   string             `json:"error_report_url,omitempty"` // full error report, once errors exist
+	CreatedAt        time.Time          `json:"created_at"`
+	CompletedAt      *time.Time         `json:"completed_at,omitempty"`
+	Progress         int                `json:"progress"`                  // percentage of the source file consumed
+	BytesProcessed   int64              `json:"bytes_processed"`           // bytes of the source file consumed
+	FileSize         int64              `json:"file_size"`                 // size of the source file
+	RowsPerSecond    float64            `json:"rows_per_second,omitempty"` // rate of the current run
+	ETASeconds       int                `json:"eta_seconds,omitempty"`     // estimated time remaining while processing
+	QueuePosition    int                `json:"queue_position,omitempty"`  // 1-based position while pending
+	Checkpoint       *ImportCheckpoint  `json:"checkpoint,omitempty"`
+	CallbackURL      string             `json:"callback_url,omitempty"`
+	CallbackSecret   string             `json:"-"`
+	Options          ImportOptions      `json:"options"`
+	DryRunResult     *DryRunResult      `json:"dry_run_result,omitempty"` // set for dry runs only
+	ParentID         string             `json:"parent_id,omitempty"`      // bundle job this file belongs to
+	Children         []ImportJobSummary `json:"children,omitempty"`       // per-file jobs of a bundle, in import order
+}
+
+// RemoteSource is the file_url an import job downloads to FilePath before it
+// is processed. A download that stops part way resumes from BytesFetched.
+type RemoteSource struct {
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"-"` // sent with the request; never stored or returned
+	Credential   string            `json:"credential,omitempty"`
+	Checksum     string            `json:"checksum,omitempty"` // expected sha256 of the file
+	BytesFetched int64             `json:"bytes_fetched"`
+	Attempts     int               `json:"attempts"`            // requests made by the latest download run
+	Validator    string            `json:"validator,omitempty"` // ETag or Last-Modified the partial file was fetched with
+	Downloaded   bool              `json:"downloaded"`
+}
+
+// BundleFile is one resource file unpacked from a bundle archive
+type BundleFile struct {
+	ResourceType string `json:"resource_type"`
+	Format       string `json:"format"`
+	Path         string `json:"-"`
+}
+
+// ImportOptions controls how an import job reads and writes its records
+type ImportOptions struct {
+	DryRun bool `json:"dry_run,omitempty"` // validate every record without writing to the database
+
+	// CSV dialect; the zero value reads comma-separated files with a header row
+	Delimiter  string `json:"delimiter,omitempty"`   // field separator, "," by default
+	Comment    string `json:"comment,omitempty"`     // lines starting with this character are skipped
+	LazyQuotes bool   `json:"lazy_quotes,omitempty"` // accept quotes inside unquoted fields and stray quotes in quoted ones
+	NoHeader   bool   `json:"no_header,omitempty"`   // the first row is data, in export column order
+
+	// Text encoding, for every format
+	Charset string `json:"charset,omitempty"`  // character set to transcode from, UTF-8 by default
+	KeepBOM bool   `json:"keep_bom,omitempty"` // leave a leading byte order mark in the content
+
+	// Column mapping, for files from a foreign schema
+	Mapping        map[string]string `json:"mapping,omitempty"`         // source column or JSON path -> field
+	MappingProfile string            `json:"mapping_profile,omitempty"` // saved profile the mapping was taken from
+
+	// Transforms clean up the values of each field before validation, in order
+	Transforms map[string][]FieldTransform `json:"transforms,omitempty"`
+}
+
+// FieldTransform is one step of the transforms applied to a field. Op is one
+// of trim, lower, upper, map, default, replace or date; the other fields are
+// the parameters of the ops that take one.
+type FieldTransform struct {
+	Op          string            `json:"op"`
+	Values      map[string]string `json:"values,omitempty"`      // map: value -> replacement
+	Value       string            `json:"value,omitempty"`       // default: used for a missing or empty value
+	Pattern     string            `json:"pattern,omitempty"`     // replace: regular expression
+	Replacement string            `json:"replacement,omitempty"` // replace: may refer to groups as $1
+	Layout      string            `json:"layout,omitempty"`      // date: Go layout of the source value, converted to RFC 3339
+}
+
+// TransformCount counts the values a transform step changed
+type TransformCount struct {
+	Field   string `json:"field"`
+	Step    int    `json:"step"` // index in the field's transforms
+	Op      string `json:"op"`
+	Changed int    `json:"changed"`
+}
+
+// MappingProfile is a saved column mapping that imports can refer to by name
+type MappingProfile struct {
+	Name         string            `json:"name"`
+	ResourceType string            `json:"resource_type"`
+	Mapping      map[string]string `json:"mapping"` // source column or JSON path -> field
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// UploadSession is a file uploaded in chunks, which an import job can use
+// once the upload is completed
+type UploadSession struct {
+	ID            string    `json:"id"`
+	FileName      string    `json:"file_name"`
+	Size          int64     `json:"size"`               // bytes the client said it would send
+	ReceivedBytes int64     `json:"received_bytes"`     // offset the next chunk starts at
+	Status        string    `json:"status"`             // open or completed
+	Checksum      string    `json:"checksum,omitempty"` // sha256 of the completed file, hex encoded
+	FilePath      string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// DryRunResult reports what a dry-run import would have done
+type DryRunResult struct {
+	ValidRecords   int `json:"valid_records"`
+	InvalidRecords int `json:"invalid_records"`
+	WouldCreate    int `json:"would_create"`
+	WouldUpdate    int `json:"would_update"`
+}
+
+// ImportPreview describes an import file as a preview detected and parsed it
+type ImportPreview struct {
+	ResourceType     string            `json:"resource_type"`
+	Format           string            `json:"format"`
+	Compression      string            `json:"compression,omitempty"`
+	Charset          string            `json:"charset"`
+	Delimiter        string            `json:"delimiter,omitempty"`
+	Columns          []string          `json:"columns"`
+	SuggestedMapping map[string]string `json:"suggested_mapping,omitempty"`
+	Mapping          map[string]string `json:"mapping,omitempty"` // the mapping the rows were parsed with
+	UnmappedColumns  []string          `json:"unmapped_columns,omitempty"`
+	MissingFields    []string          `json:"missing_fields,omitempty"` // required fields no column fills
+	Rows             []PreviewRow      `json:"rows"`
+	ValidRows        int               `json:"valid_rows"`
+}
+
+// PreviewRow is one record of a preview with its validation results
+type PreviewRow struct {
+	Row    int               `json:"row"`
+	Record any               `json:"record,omitempty"` // nil when the record could not be parsed
+	Valid  bool              `json:"valid"`
+	Errors []ValidationError `json:"errors,omitempty"`
+}
+
+// ImportCheckpoint records how far an import got after its last flushed batch
+type ImportCheckpoint struct {
+	ByteOffset        int64 `json:"byte_offset"`                   // offset in the source file just past the last batch
+	RowNumber         int   `json:"row_number"`                    // records consumed up to ByteOffset
+	ValidRecords      int   `json:"valid_records"`                 // valid records committed up to ByteOffset
+	ErrorCount        int   `json:"error_count"`                   // errors recorded up to ByteOffset
+	ErrorReportOffset int64 `json:"error_report_offset,omitempty"` // size of the job's error report at ByteOffset
+}
+
+// ExportJob represents an asynchronous export job
+type ExportJob struct {
+	ID             string            `json:"id"`
+	Status         string            `json:"status"` // pending, processing, completed, failed, cancelled
+	ResourceType   string            `json:"resource_type"`
+	Format         string            `json:"format"`
+	Filters        map[string]string `json:"filters"`
+	TotalRecords   int               `json:"total_records"`
+	DownloadURL    string            `json:"download_url,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	CompletedAt    *time.Time        `json:"completed_at,omitempty"`
+	Progress       int               `json:"progress"`                 // percentage
+	QueuePosition  int               `json:"queue_position,omitempty"` // 1-based position while pending
+	CallbackURL    string            `json:"callback_url,omitempty"`
+	CallbackSecret string            `json:"-"`
+	Destination    string            `json:"destination,omitempty"` // "local" or s3://bucket/prefix; the server default when empty
+}
+
+// ImportJobSummary is an import job without its error details, used in listings
+type ImportJobSummary struct {
+	ID               string        `json:"id"`
+	Status           string        `json:"status"`
+	ResourceType     string        `json:"resource_type"`
+	Format           string        `json:"format"`
+	FileName         string        `json:"file_name"`
+	SourceDigest     string        `json:"source_digest,omitempty"`
+	TotalRecords     int           `json:"total_records"`
+	ValidRecords     int           `json:"valid_records"`
+	ErrorRecords     int           `json:"error_records"`
+	CommittedBatches int           `json:"committed_batches"`
+	CreatedAt        time.Time     `json:"created_at"`
+	CompletedAt      *time.Time    `json:"completed_at,omitempty"`
+	Progress         int           `json:"progress"`
+	BytesDownloaded  int64         `json:"bytes_downloaded,omitempty"`
+	RowsPerSecond    float64       `json:"rows_per_second,omitempty"`
+	ETASeconds       int           `json:"eta_seconds,omitempty"`
+	DryRun           bool          `json:"dry_run,omitempty"`
+	DryRunResult     *DryRunResult `json:"dry_run_result,omitempty"`
+	ParentID         string        `json:"parent_id,omitempty"`
+}
+
+// ExportJobSummary is an export job as shown in listings
+type ExportJobSummary struct {
+	ID           string            `json:"id"`
+	Status       string            `json:"status"`
+	ResourceType string            `json:"resource_type"`
+	Format       string            `json:"format"`
+	Filters      map[string]string `json:"filters,omitempty"`
+	TotalRecords int               `json:"total_records"`
+	DownloadURL  string            `json:"download_url,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	CompletedAt  *time.Time        `json:"completed_at,omitempty"`
+	Progress     int               `json:"progress"`
+}
+
+// ImportRequest represents a request to import data
+type ImportRequest struct {
+	ResourceType   string            `json:"resource_type" validate:"required,oneof=users articles comments bundle"`
+	FileURL        string            `json:"file_url,omitempty"`
+	UploadID       string            `json:"upload_id,omitempty"`       // a completed upload session, instead of file_url
+	FileHeaders    map[string]string `json:"file_headers,omitempty"`    // sent when downloading file_url; not stored
+	FileCredential string            `json:"file_credential,omitempty"` // server-side credential for file_url
+	FileChecksum   string            `json:"file_checksum,omitempty"`   // expected sha256 of the downloaded file
+	Format         string            `json:"format" validate:"required,oneof=csv ndjson json zip tar"`
+	CallbackURL    string            `json:"callback_url,omitempty" validate:"omitempty,url"`
+	CallbackSecret string            `json:"callback_secret,omitempty"` // signs the webhook; defaults to the server secret
+	ImportOptions
+}
+
+// ImportPreviewRequest represents a request to preview an import file
+type ImportPreviewRequest struct {
+	ResourceType   string            `json:"resource_type" validate:"required,oneof=users articles comments"`
+	FileURL        string            `json:"file_url"`
+	FileHeaders    map[string]string `json:"file_headers,omitempty"`
+	FileCredential string            `json:"file_credential,omitempty"`
+	Format         string            `json:"format,omitempty" validate:"omitempty,oneof=csv ndjson json"` // detected when empty
+	Rows           int               `json:"rows,omitempty"`                                              // records to parse; defaults to 10
+	ImportOptions
+}
+
+// UploadSessionRequest represents a request to start a chunked upload
+type UploadSessionRequest struct {
+	FileName string `json:"file_name" validate:"required"`
+	Size     int64  `json:"size" validate:"required,gt=0"`
+}
+
+// CompleteUploadRequest represents a request to finish a chunked upload
+type CompleteUploadRequest struct {
+	Checksum string `json:"checksum" validate:"required"` // sha256 of the whole file, hex encoded
+}
+
+// ExportRequest represents a request to export data
+type ExportRequest struct {
+	ResourceType   string            `json:"resource_type" validate:"required,oneof=users articles comments"`
+	Format         string            `json:"format" validate:"required,oneof=csv ndjson json"`
+	Filters        map[string]string `json:"filters,omitempty"`
+	Fields         []string          `json:"fields,omitempty"`
+	CallbackURL    string            `json:"callback_url,omitempty" validate:"omitempty,url"`
+	CallbackSecret string            `json:"callback_secret,omitempty"` // signs the webhook; defaults to the server secret
+	Destination    string            `json:"destination,omitempty"`     // "local" or s3://bucket/prefix; defaults to EXPORT_LOCATION
+}
+
+// MappingProfileRequest represents a request to save a column mapping profile
+type MappingProfileRequest struct {
+	ResourceType string            `json:"resource_type" validate:"required,oneof=users articles comments"`
+	Mapping      map[string]string `json:"mapping" validate:"required"`
+}
+
+// IdempotencyKey records the job created for an Idempotency-Key header
+type IdempotencyKey struct {
+	Scope       string    `json:"scope"` // imports or exports
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"` // hash of the request the key was first used with
+	JobID       string    `json:"job_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Summary returns the listing view of an import job
+func (j *ImportJob) Summary() ImportJobSummary {
+	var bytesDownloaded int64
+	if j.Source != nil {
+		bytesDownloaded = j.Source.BytesFetched
+	}
+	summary := ImportJobSummary{
+		ID:               j.ID,
+		Status:           j.Status,
+		ResourceType:     j.ResourceType,
+		Format:           j.Format,
+		FileName:         j.FileName,
+		SourceDigest:     j.SourceDigest,
+		TotalRecords:     j.TotalRecords,
+		ValidRecords:     j.ValidRecords,
+		ErrorRecords:     j.ErrorRecords,
+		CommittedBatches: j.CommittedBatches,
+		CreatedAt:        j.CreatedAt,
+		CompletedAt:      j.CompletedAt,
+		Progress:         j.Progress,
+		BytesDownloaded:  bytesDownloaded,
+		RowsPerSecond:    j.RowsPerSecond,
+		ETASeconds:       j.ETASeconds,
+		DryRun:           j.Options.DryRun,
+		ParentID:         j.ParentID,
+	}
+	if j.DryRunResult != nil {
+		// A copy, since the running job keeps updating its own
+		result := *j.DryRunResult
+		summary.DryRunResult = &result
+	}
+	return summary
+}
+
+// Summary returns the listing view of an export job
+func (j *ExportJob) Summary() ExportJobSummary {
+	return ExportJobSummary{
+		ID:           j.ID,
+		Status:       j.Status,
+		ResourceType: j.ResourceType,
+		Format:       j.Format,
+		Filters:      j.Filters,
+		TotalRecords: j.TotalRecords,
+		DownloadURL:  j.DownloadURL,
+		CreatedAt:    j.CreatedAt,
+		CompletedAt:  j.CompletedAt,
+		Progress:     j.Progress,
+	}
+}
+
+// FileName returns the name of the export's download file, or "" before it completes
+func (j *ExportJob) FileName() string {
+	if j.DownloadURL == "" {
+		return ""
+	}
+	return path.Base(j.DownloadURL)
+}
+
+// GetNaturalKey returns the natural key for upsert operations
+func (u *User) GetNaturalKey() string {
+	return u.Email
+}
+
+// GetNaturalKey returns the natural key for upsert operations
+func (a *Article) GetNaturalKey() string {
+	return a.Slug
+}
+
+// GenerateID generates a new UUID for the record if not set
+func (u *User) GenerateID() {
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+}
+
+// GenerateID generates a new UUID for the record if not set
+func (a *Article) GenerateID() {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+}
+
+// GenerateID generates a new UUID for the record if not set
+func (c *Comment) GenerateID() {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+}
+
+// SetTimestamps sets created_at and updated_at for new records
+func (u *User) SetTimestamps() {
+	now := time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	u.UpdatedAt = now
+}
+
+// SetTimestamps sets created_at and updated_at for new records
+func (a *Article) SetTimestamps() {
+	now := time.Now()
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = now
+	}
+	a.UpdatedAt = now
+}
+
+// SetTimestamps sets created_at for new comments
+func (c *Comment) SetTimestamps() {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+}
@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/seal"
+)
+
+// sealSecret encrypts a callback secret to be stored. Without a secret box
+// nothing is stored, as the secret would be readable by anyone with access
+// to the database.
+func (s *Storage) sealSecret(secret string) (string, error) {
+	if secret == "" || s.secrets == nil {
+		return "", nil
+	}
+	sealed, err := s.secrets.Seal(secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal callback secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// openSecret decrypts a stored callback secret. One stored before secrets
+// were sealed is returned as it is, and one that can't be opened is dropped,
+// so the job's deliveries fall back to the server secret.
+func (s *Storage) openSecret(jobID, stored string) string {
+	if !seal.IsSealed(stored) {
+		return stored
+	}
+	if s.secrets == nil {
+		log.Printf("Callback secret of job %s can't be opened without CALLBACK_SECRET_KEY", jobID)
+		return ""
+	}
+	secret, err := s.secrets.Open(stored)
+	if err != nil {
+		log.Printf("Failed to open callback secret of job %s: %v", jobID, err)
+		return ""
+	}
+	return secret
+}
+
+// SaveImportJob inserts or updates an import job together with its errors
+func (s *Storage) SaveImportJob(job *models.ImportJob) error {
+	errorsJSON, err := json.Marshal(job.Errors)
+	if err != nil {
+		return fmt.Errorf("failed to encode job errors: %w", err)
+	}
+
+	warningsJSON, err := json.Marshal(job.Warnings)
+	if err != nil {
+		return fmt.Errorf("failed to encode job warnings: %w", err)
+	}
+
+	transformCountsJSON, err := json.Marshal(job.TransformCounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode transform counts: %w", err)
+	}
+
+	var checkpointJSON interface{} // NULL until the first batch is flushed
+	if job.Checkpoint != nil {
+		encoded, err := json.Marshal(job.Checkpoint)
+		if err != nil {
+			return fmt.Errorf("failed to encode job checkpoint: %w", err)
+		}
+		checkpointJSON = encoded
+	}
+
+	optionsJSON, err := json.Marshal(job.Options)
+	if err != nil {
+		return fmt.Errorf("failed to encode job options: %w", err)
+	}
+
+	var dryRunJSON interface{} // NULL unless the job is a dry run
+	if job.DryRunResult != nil {
+		encoded, err := json.Marshal(job.DryRunResult)
+		if err != nil {
+			return fmt.Errorf("failed to encode dry run result: %w", err)
+		}
+		dryRunJSON = encoded
+	}
+
+	var sourceJSON interface{} // NULL unless the job downloads a file_url; headers are never stored
+	if job.Source != nil {
+		encoded, err := json.Marshal(job.Source)
+		if err != nil {
+			return fmt.Errorf("failed to encode job source: %w", err)
+		}
+		sourceJSON = encoded
+	}
+
+	callbackSecret, err := s.sealSecret(job.CallbackSecret)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO import_jobs (id, status, resource_type, format, file_name, file_path, total_records,
+			valid_records, error_records, committed_batches, errors, checkpoint, progress, created_at, completed_at,
+			callback_url, callback_secret, options, dry_run_result, parent_id, warnings, transform_counts, source,
+			source_digest)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23,
+			$24)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			file_name = EXCLUDED.file_name,
+			file_path = EXCLUDED.file_path,
+			callback_url = EXCLUDED.callback_url,
+			callback_secret = EXCLUDED.callback_secret,
+			options = EXCLUDED.options,
+			dry_run_result = EXCLUDED.dry_run_result,
+			checkpoint = EXCLUDED.checkpoint,
+			total_records = EXCLUDED.total_records,
+			valid_records = EXCLUDED.valid_records,
+			error_records = EXCLUDED.error_records,
+			committed_batches = EXCLUDED.committed_batches,
+			errors = EXCLUDED.errors,
+			warnings = EXCLUDED.warnings,
+			transform_counts = EXCLUDED.transform_counts,
+			source = EXCLUDED.source,
+			source_digest = EXCLUDED.source_digest,
+			progress = EXCLUDED.progress,
+			completed_at = EXCLUDED.completed_at
+	`, job.ID, job.Status, job.ResourceType, job.Format, job.FileName, job.FilePath, job.TotalRecords,
+		job.ValidRecords, job.ErrorRecords, job.CommittedBatches, errorsJSON, checkpointJSON, job.Progress,
+		job.CreatedAt, job.CompletedAt, job.CallbackURL, callbackSecret, optionsJSON, dryRunJSON, job.ParentID,
+		warningsJSON, transformCountsJSON, sourceJSON, job.SourceDigest)
+	return err
+}
+
+// SaveExportJob inserts or updates an export job
+func (s *Storage) SaveExportJob(job *models.ExportJob) error {
+	filtersJSON, err := json.Marshal(job.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to encode job filters: %w", err)
+	}
+	callbackSecret, err := s.sealSecret(job.CallbackSecret)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO export_jobs (id, status, resource_type, format, filters, total_records,
+			download_url, progress, created_at, completed_at, callback_url, callback_secret, destination)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			callback_url = EXCLUDED.callback_url,
+			callback_secret = EXCLUDED.callback_secret,
+			destination = EXCLUDED.destination,
+			total_records = EXCLUDED.total_records,
+			download_url = EXCLUDED.download_url,
+			progress = EXCLUDED.progress,
+			completed_at = EXCLUDED.completed_at
+	`, job.ID, job.Status, job.ResourceType, job.Format, filtersJSON, job.TotalRecords,
+		job.DownloadURL, job.Progress, job.CreatedAt, job.CompletedAt, job.CallbackURL, callbackSecret,
+		job.Destination)
+	return err
+}
+
+// LoadImportJobs returns every persisted import job
+func (s *Storage) LoadImportJobs() ([]*models.ImportJob, error) {
+	rows, err := s.db.Query(`
+		SELECT id, status, resource_type, format, file_name, file_path, total_records, valid_records,
+			error_records, committed_batches, errors, checkpoint, progress, created_at, completed_at,
+			callback_url, callback_secret, options, dry_run_result, parent_id, warnings, transform_counts, source,
+			source_digest
+		FROM import_jobs
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.ImportJob
+	for rows.Next() {
+		var job models.ImportJob
+		var errorsJSON, checkpointJSON, optionsJSON, dryRunJSON, warningsJSON, transformCountsJSON, sourceJSON []byte
+		err := rows.Scan(&job.ID, &job.Status, &job.ResourceType, &job.Format, &job.FileName, &job.FilePath,
+			&job.TotalRecords, &job.ValidRecords, &job.ErrorRecords, &job.CommittedBatches, &errorsJSON,
+			&checkpointJSON, &job.Progress, &job.CreatedAt, &job.CompletedAt, &job.CallbackURL, &job.CallbackSecret,
+			&optionsJSON, &dryRunJSON, &job.ParentID, &warningsJSON, &transformCountsJSON, &sourceJSON,
+			&job.SourceDigest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import job: %w", err)
+		}
+		job.CallbackSecret = s.openSecret(job.ID, job.CallbackSecret)
+		if err := json.Unmarshal(errorsJSON, &job.Errors); err != nil {
+			return nil, fmt.Errorf("failed to decode errors for import job %s: %w", job.ID, err)
+		}
+		if err := json.Unmarshal(warningsJSON, &job.Warnings); err != nil {
+			return nil, fmt.Errorf("failed to decode warnings for import job %s: %w", job.ID, err)
+		}
+		if err := json.Unmarshal(transformCountsJSON, &job.TransformCounts); err != nil {
+			return nil, fmt.Errorf("failed to decode transform counts for import job %s: %w", job.ID, err)
+		}
+		if checkpointJSON != nil {
+			job.Checkpoint = &models.ImportCheckpoint{}
+			if err := json.Unmarshal(checkpointJSON, job.Checkpoint); err != nil {
+				return nil, fmt.Errorf("failed to decode checkpoint for import job %s: %w", job.ID, err)
+			}
+		}
+		if err := json.Unmarshal(optionsJSON, &job.Options); err != nil {
+			return nil, fmt.Errorf("failed to decode options for import job %s: %w", job.ID, err)
+		}
+		if dryRunJSON != nil {
+			job.DryRunResult = &models.DryRunResult{}
+			if err := json.Unmarshal(dryRunJSON, job.DryRunResult); err != nil {
+				return nil, fmt.Errorf("failed to decode dry run result for import job %s: %w", job.ID, err)
+			}
+		}
+		if sourceJSON != nil {
+			job.Source = &models.RemoteSource{}
+			if err := json.Unmarshal(sourceJSON, job.Source); err != nil {
+				return nil, fmt.Errorf("failed to decode source for import job %s: %w", job.ID, err)
+			}
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// LoadExportJobs returns every persisted export job
+func (s *Storage) LoadExportJobs() ([]*models.ExportJob, error) {
+	rows, err := s.db.Query(`
+		SELECT id, status, resource_type, format, filters, total_records,
+			download_url, progress, created_at, completed_at, callback_url, callback_secret, destination
+		FROM export_jobs
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.ExportJob
+	for rows.Next() {
+		var job models.ExportJob
+		var filtersJSON []byte
+		err := rows.Scan(&job.ID, &job.Status, &job.ResourceType, &job.Format, &filtersJSON,
+			&job.TotalRecords, &job.DownloadURL, &job.Progress, &job.CreatedAt, &job.CompletedAt,
+			&job.CallbackURL, &job.CallbackSecret, &job.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan export job: %w", err)
+		}
+		job.CallbackSecret = s.openSecret(job.ID, job.CallbackSecret)
+		if err := json.Unmarshal(filtersJSON, &job.Filters); err != nil {
+			return nil, fmt.Errorf("failed to decode filters for export job %s: %w", job.ID, err)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// DeleteJobsBefore removes import and export jobs created before the cutoff
+func (s *Storage) DeleteJobsBefore(cutoff time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM import_jobs WHERE created_at < $1", cutoff); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("DELETE FROM export_jobs WHERE created_at < $1", cutoff)
+	return err
+}
+
+// SaveIdempotencyKey inserts or replaces an idempotency key
+func (s *Storage) SaveIdempotencyKey(key *models.IdempotencyKey) error {
+	_, err := s.db.Exec(`
+		INSERT INTO idempotency_keys (scope, key, fingerprint, job_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			job_id = EXCLUDED.job_id,
+			created_at = EXCLUDED.created_at
+	`, key.Scope, key.Key, key.Fingerprint, key.JobID, key.CreatedAt)
+	return err
+}
+
+// LoadIdempotencyKeys returns every persisted idempotency key
+func (s *Storage) LoadIdempotencyKeys() ([]*models.IdempotencyKey, error) {
+	rows, err := s.db.Query("SELECT scope, key, fingerprint, job_id, created_at FROM idempotency_keys")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.IdempotencyKey
+	for rows.Next() {
+		var key models.IdempotencyKey
+		if err := rows.Scan(&key.Scope, &key.Key, &key.Fingerprint, &key.JobID, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan idempotency key: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteIdempotencyKeysBefore removes idempotency keys created before the cutoff
+func (s *Storage) DeleteIdempotencyKeysBefore(cutoff time.Time) error {
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE created_at < $1", cutoff)
+	return err
+}
+
+// SaveMappingProfile inserts or replaces a column mapping profile
+func (s *Storage) SaveMappingProfile(profile *models.MappingProfile) error {
+	mappingJSON, err := json.Marshal(profile.Mapping)
+	if err != nil {
+		return fmt.Errorf("failed to encode mapping: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO mapping_profiles (name, resource_type, mapping, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			resource_type = EXCLUDED.resource_type,
+			mapping = EXCLUDED.mapping,
+			updated_at = EXCLUDED.updated_at
+	`, profile.Name, profile.ResourceType, mappingJSON, profile.CreatedAt, profile.UpdatedAt)
+	return err
+}
+
+// LoadMappingProfiles returns every saved column mapping profile
+func (s *Storage) LoadMappingProfiles() ([]*models.MappingProfile, error) {
+	rows, err := s.db.Query("SELECT name, resource_type, mapping, created_at, updated_at FROM mapping_profiles")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []*models.MappingProfile
+	for rows.Next() {
+		var profile models.MappingProfile
+		var mappingJSON []byte
+		if err := rows.Scan(&profile.Name, &profile.ResourceType, &mappingJSON, &profile.CreatedAt, &profile.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mapping profile: %w", err)
+		}
+		if err := json.Unmarshal(mappingJSON, &profile.Mapping); err != nil {
+			return nil, fmt.Errorf("failed to decode mapping profile %s: %w", profile.Name, err)
+		}
+		profiles = append(profiles, &profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+// DeleteMappingProfile removes a column mapping profile
+func (s *Storage) DeleteMappingProfile(name string) error {
+	_, err := s.db.Exec("DELETE FROM mapping_profiles WHERE name = $1", name)
+	return err
+}
+
+// SaveUploadSession inserts or updates a chunked upload session
+func (s *Storage) SaveUploadSession(session *models.UploadSession) error {
+	_, err := s.db.Exec(`
+		INSERT INTO upload_sessions (id, file_name, size, received_bytes, status, checksum, file_path,
+			created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			received_bytes = EXCLUDED.received_bytes,
+			status = EXCLUDED.status,
+			checksum = EXCLUDED.checksum,
+			file_path = EXCLUDED.file_path,
+			updated_at = EXCLUDED.updated_at,
+			expires_at = EXCLUDED.expires_at
+	`, session.ID, session.FileName, session.Size, session.ReceivedBytes, session.Status, session.Checksum,
+		session.FilePath, session.CreatedAt, session.UpdatedAt, session.ExpiresAt)
+	return err
+}
+
+// LoadUploadSessions returns every saved upload session
+func (s *Storage) LoadUploadSessions() ([]*models.UploadSession, error) {
+	rows, err := s.db.Query(`
+		SELECT id, file_name, size, received_bytes, status, checksum, file_path, created_at, updated_at, expires_at
+		FROM upload_sessions
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.UploadSession
+	for rows.Next() {
+		var session models.UploadSession
+		if err := rows.Scan(&session.ID, &session.FileName, &session.Size, &session.ReceivedBytes, &session.Status,
+			&session.Checksum, &session.FilePath, &session.CreatedAt, &session.UpdatedAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan upload session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteUploadSession removes a chunked upload session
+func (s *Storage) DeleteUploadSession(id string) error {
+	_, err := s.db.Exec("DELETE FROM upload_sessions WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,162 @@
+// Package digest checks content against the digests its sender gave for it,
+// in a Content-Digest or Content-MD5 header or as a plain SHA-256
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrMismatch is returned when content does not match a digest given for it
+	ErrMismatch = errors.New("content does not match its digest")
+	// ErrInvalid is returned for a digest that can't be parsed
+	ErrInvalid = errors.New("invalid digest")
+)
+
+// algorithms are the hashes a digest can be checked with, by their Content-Digest names
+var algorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+	"md5":     md5.New, // Content-MD5 only; RFC 9530 deprecates it for Content-Digest
+}
+
+// Digest is a hash that content is expected to have
+type Digest struct {
+	Algorithm string // sha-256, sha-512 or md5
+	Sum       []byte
+}
+
+// FromHeader returns the digests given in the Content-Digest and Content-MD5
+// headers, which describe the body of the message they are sent with
+func FromHeader(header http.Header) ([]Digest, error) {
+	var digests []Digest
+	if value := header.Get("Content-Digest"); value != "" {
+		parsed, err := ParseContentDigest(value)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, parsed...)
+	}
+	if value := header.Get("Content-MD5"); value != "" {
+		parsed, err := ParseContentMD5(value)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, parsed)
+	}
+	return digests, nil
+}
+
+// ParseContentDigest parses a Content-Digest header (RFC 9530), such as
+// "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:". Digests in
+// algorithms other than sha-256 and sha-512 are skipped, but a header with
+// none of those is an error, since nothing in it could be checked.
+func ParseContentDigest(value string) ([]Digest, error) {
+	var digests []Digest
+	for _, member := range strings.Split(value, ",") {
+		name, sum, found := strings.Cut(strings.TrimSpace(member), "=")
+		if !found {
+			return nil, fmt.Errorf("%w: Content-Digest member %q has no value", ErrInvalid, member)
+		}
+		name = strings.ToLower(name)
+		if name == "md5" || algorithms[name] == nil {
+			continue
+		}
+		sum, _, _ = strings.Cut(sum, ";") // parameters
+		encoded, ok := strings.CutPrefix(sum, ":")
+		if encoded, ok = strings.CutSuffix(encoded, ":"); !ok {
+			return nil, fmt.Errorf("%w: Content-Digest %s must be a :base64: byte sequence", ErrInvalid, name)
+		}
+		digest, err := decode(name, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: Content-Digest %s", err, name)
+		}
+		digests = append(digests, digest)
+	}
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("%w: Content-Digest must include sha-256 or sha-512", ErrInvalid)
+	}
+	return digests, nil
+}
+
+// ParseContentMD5 parses a Content-MD5 header, the base64 encoded MD5 of the body
+func ParseContentMD5(value string) (Digest, error) {
+	digest, err := decode("md5", strings.TrimSpace(value))
+	if err != nil {
+		return Digest{}, fmt.Errorf("%w: Content-MD5", err)
+	}
+	return digest, nil
+}
+
+// ParseSHA256 parses a hex encoded SHA-256, optionally prefixed with "sha256:"
+func ParseSHA256(value string) (Digest, error) {
+	sum, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(value), "sha256:"))
+	if err != nil || len(sum) != sha256.Size {
+		return Digest{}, fmt.Errorf("%w: sha256 must be a hex encoded SHA-256, optionally prefixed with sha256:", ErrInvalid)
+	}
+	return Digest{Algorithm: "sha-256", Sum: sum}, nil
+}
+
+// decode decodes the base64 sum of a digest and checks its length
+func decode(algorithm, encoded string) (Digest, error) {
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sum) != algorithms[algorithm]().Size() {
+		return Digest{}, fmt.Errorf("%w: not a base64 encoded %s", ErrInvalid, algorithm)
+	}
+	return Digest{Algorithm: algorithm, Sum: sum}, nil
+}
+
+// Verifier hashes the content written to it, to check it against the
+// digests given for it. It always computes the SHA-256 of the content, which
+// is what jobs record.
+type Verifier struct {
+	expected []Digest
+	hashes   map[string]hash.Hash
+	writer   io.Writer
+}
+
+// NewVerifier returns a Verifier for content expected to match every digest
+func NewVerifier(expected ...Digest) *Verifier {
+	v := &Verifier{expected: expected, hashes: map[string]hash.Hash{"sha-256": sha256.New()}}
+	for _, digest := range expected {
+		if v.hashes[digest.Algorithm] == nil {
+			v.hashes[digest.Algorithm] = algorithms[digest.Algorithm]()
+		}
+	}
+	writers := make([]io.Writer, 0, len(v.hashes))
+	for _, h := range v.hashes {
+		writers = append(writers, h)
+	}
+	v.writer = io.MultiWriter(writers...)
+	return v
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	return v.writer.Write(p)
+}
+
+// Verify returns ErrMismatch for the first digest the content written doesn't match
+func (v *Verifier) Verify() error {
+	for _, digest := range v.expected {
+		if subtle.ConstantTimeCompare(v.hashes[digest.Algorithm].Sum(nil), digest.Sum) != 1 {
+			return fmt.Errorf("%w (%s)", ErrMismatch, digest.Algorithm)
+		}
+	}
+	return nil
+}
+
+// SHA256 returns the "sha256:<hex>" of the content written so far
+func (v *Verifier) SHA256() string {
+	return "sha256:" + hex.EncodeToString(v.hashes["sha-256"].Sum(nil))
+}
@@ -0,0 +1,64 @@
+package digest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVerifierChecksHeaderDigests(t *testing.T) {
+	// The example of RFC 9530, section 2
+	content := `{"hello": "world"}`
+	header := http.Header{}
+	header.Set("Content-Digest", "unixsum=:AAAA:, sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:")
+	header.Set("Content-MD5", "Sd/dVLAcvNLSq16eXua5uQ==")
+
+	digests, err := FromHeader(header)
+	if err != nil {
+		t.Fatalf("FromHeader failed: %v", err)
+	}
+	if len(digests) != 2 || digests[0].Algorithm != "sha-256" || digests[1].Algorithm != "md5" {
+		t.Fatalf("Expected a sha-256 and an md5 digest, skipping unixsum, got %+v", digests)
+	}
+
+	verifier := NewVerifier(digests...)
+	io.Copy(verifier, strings.NewReader(content))
+	if err := verifier.Verify(); err != nil {
+		t.Errorf("Expected the content to match, got %v", err)
+	}
+	if verifier.SHA256() != "sha256:5f8f04f6a3a892aaabbddb6cf273894493773960d4a325b105fee46eef4304f1" {
+		t.Errorf("Unexpected SHA256 %s", verifier.SHA256())
+	}
+
+	verifier = NewVerifier(digests...)
+	io.Copy(verifier, strings.NewReader(content+"\n"))
+	if err := verifier.Verify(); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Expected a mismatch, got %v", err)
+	}
+}
+
+func TestParseRejectsInvalidDigests(t *testing.T) {
+	invalid := []string{
+		"sha-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=", // not a byte sequence
+		"sha-256=:AAAA:", // wrong length
+		"unixsum=:AAAA:", // nothing that can be checked
+		"sha-256",        // no value
+		"md5=:Sd/dVLAcvNLSq16eXua5uQ==:",
+	}
+	for _, value := range invalid {
+		if _, err := ParseContentDigest(value); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected Content-Digest %q to be invalid, got %v", value, err)
+		}
+	}
+	if _, err := ParseContentMD5("not base64"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid Content-MD5, got %v", err)
+	}
+	if _, err := ParseSHA256("sha256:abc"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid sha256, got %v", err)
+	}
+	if _, err := ParseSHA256("sha256:" + strings.Repeat("0f", 32)); err != nil {
+		t.Errorf("Expected a prefixed sha256 to parse, got %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/pkg/digest"
+	"golang.org/x/net/http/httpguts"
+)
+
+var (
+	// ErrUnknownCredential is returned when a request names a credential that is not configured
+	ErrUnknownCredential = errors.New("unknown credential")
+	// ErrTooLarge is returned when a file is larger than a download may write
+	ErrTooLarge = errors.New("file size exceeds maximum allowed size")
+	// ErrChecksumMismatch is returned when a downloaded file does not match its expected checksum
+	ErrChecksumMismatch = errors.New("downloaded file does not match its checksum")
+	// errRangeMismatch is returned when a server answers a resumed download with the wrong range
+	errRangeMismatch = errors.New("server did not resume the download at the requested offset")
+)
+
+// reservedHeaders are set by the fetcher and may not be sent by a request
+var reservedHeaders = map[string]bool{
+	"Host":              true,
+	"Range":             true,
+	"If-Range":          true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Accept-Encoding":   true,
+}
+
+// progressInterval is how often a running download reports its progress
+const progressInterval = time.Second
+
+// Request describes a file to download
+type Request struct {
+	URL        string
+	Headers    map[string]string // sent with the request, but not to another host it redirects to
+	Credential string            // a configured credential whose headers are sent too
+	Checksum   string            // expected "sha256:<hex>" of the whole file; optional
+	MaxSize    int64             // a lower limit than the configured one, when positive
+	Validator  string            // ETag or Last-Modified the partial file on disk was fetched with
+}
+
+// Progress reports how far a download has got
+type Progress struct {
+	Received  int64 // bytes of the file on disk
+	Total     int64 // size of the whole file, or -1 while unknown
+	Attempts  int   // requests made by this download
+	Validator string
+}
+
+// StatusError is returned when a server answers with a status other than the file
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// ValidateRequest checks the URL, headers, credential and checksum of a
+// request before anything is fetched
+func (f *Fetcher) ValidateRequest(req Request) error {
+	if err := f.CheckURL(req.URL); err != nil {
+		return err
+	}
+	for key, value := range req.Headers {
+		if !httpguts.ValidHeaderFieldName(key) || !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid header %q", key)
+		}
+		if reservedHeaders[http.CanonicalHeaderKey(key)] {
+			return fmt.Errorf("header %s is set by the server and can't be sent", http.CanonicalHeaderKey(key))
+		}
+	}
+	if req.Credential != "" {
+		if _, exists := f.config.Credentials[req.Credential]; !exists {
+			return fmt.Errorf("%w %q", ErrUnknownCredential, req.Credential)
+		}
+	}
+	if req.Checksum != "" {
+		if _, err := parseChecksum(req.Checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download saves the file at req.URL to path. Bytes already in path are kept
+// and only the rest is requested, with a Range header, so a download cut off
+// by a network error or an earlier run resumes where it stopped. Network
+// errors and 408, 429 and 5xx answers are retried with exponential backoff.
+// A response is checked against the Content-Digest or Content-MD5 the server
+// sends with it, and the complete file against req.Checksum. progress, when
+// not nil, is called while the file downloads and after every attempt.
+// Download returns the "sha256:<hex>" of the file.
+func (f *Fetcher) Download(ctx context.Context, req Request, path string, progress func(Progress)) (string, error) {
+	if err := f.ValidateRequest(req); err != nil {
+		return "", err
+	}
+	header := f.requestHeader(req)
+	maxSize := f.config.MaxSize
+	if req.MaxSize > 0 && (maxSize <= 0 || req.MaxSize < maxSize) {
+		maxSize = req.MaxSize
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	state := Progress{Received: info.Size(), Total: -1, Validator: req.Validator}
+	for {
+		state.Attempts++
+		err := f.attempt(ctx, req.URL, header, file, &state, maxSize, progress)
+		if progress != nil {
+			progress(state)
+		}
+		if err == nil {
+			break
+		}
+		if state.Attempts > f.config.Retries || !retryable(err) || ctx.Err() != nil {
+			return "", err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(f.config.RetryBackoff << (state.Attempts - 1)):
+		}
+	}
+
+	return verifyChecksum(file, req.Checksum)
+}
+
+// attempt makes one request for the part of the file not yet on disk
+func (f *Fetcher) attempt(ctx context.Context, rawURL string, header http.Header, file *os.File, state *Progress, maxSize int64, progress func(Progress)) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header = header.Clone()
+	if state.Received > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", state.Received))
+		if state.Validator != "" {
+			// A file that changed since is sent whole instead of a range of it
+			httpReq.Header.Set("If-Range", state.Validator)
+		}
+	}
+
+	resp, err := f.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && state.Received > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != state.Received {
+			return restart(file, state)
+		}
+		state.Total = total
+	case resp.StatusCode == http.StatusOK:
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		state.Received = 0
+		state.Total = resp.ContentLength
+		state.Validator = responseValidator(resp.Header)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && state.Received > 0:
+		// Nothing is left after the offset if the partial file is already whole
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == state.Received {
+			state.Total = total
+			return nil
+		}
+		return restart(file, state)
+	default:
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if maxSize > 0 && state.Total > maxSize {
+		return ErrTooLarge
+	}
+	if _, err := file.Seek(state.Received, io.SeekStart); err != nil {
+		return err
+	}
+
+	// A digest sent by the server covers the bytes of this response alone. It
+	// can't be checked when the transport has decompressed them.
+	body := io.Reader(resp.Body)
+	var verifier *digest.Verifier
+	if expected, err := digest.FromHeader(resp.Header); err == nil && len(expected) > 0 && !resp.Uncompressed {
+		verifier = digest.NewVerifier(expected...)
+		body = io.TeeReader(body, verifier)
+	}
+	if maxSize > 0 {
+		body = io.LimitReader(body, maxSize-state.Received+1)
+	}
+	_, err = io.Copy(&progressWriter{file: file, state: state, progress: progress, reported: time.Now()}, body)
+	if maxSize > 0 && state.Received > maxSize {
+		return ErrTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	if state.Total >= 0 && state.Received < state.Total {
+		return io.ErrUnexpectedEOF
+	}
+	if verifier != nil {
+		if err := verifier.Verify(); err != nil {
+			// The bad bytes can't be told apart from the good, so the file is fetched whole again
+			restart(file, state)
+			return fmt.Errorf("%w: %v", ErrChecksumMismatch, err)
+		}
+	}
+	return nil
+}
+
+// requestHeader builds the headers of a request, from its own headers and its credential
+func (f *Fetcher) requestHeader(req Request) http.Header {
+	header := make(http.Header)
+	for key, value := range req.Headers {
+		header.Set(key, value)
+	}
+	for key, value := range f.config.Credentials[req.Credential] {
+		header.Set(key, value)
+	}
+	return header
+}
+
+// restart discards the partial file so the next attempt fetches it whole
+func restart(file *os.File, state *Progress) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	state.Received = 0
+	state.Total = -1
+	state.Validator = ""
+	return errRangeMismatch
+}
+
+// retryable reports whether a failed attempt may succeed if tried again
+func retryable(err error) bool {
+	if _, blocked := IsBlocked(err); blocked {
+		return false
+	}
+	if errors.Is(err, ErrTooLarge) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusRequestTimeout ||
+			status.StatusCode == http.StatusTooManyRequests ||
+			status.StatusCode >= 500
+	}
+	return true
+}
+
+// responseValidator returns what identifies this version of a file in an
+// If-Range header: a strong ETag, or else the Last-Modified date
+func responseValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// parseContentRange parses "bytes <start>-<end>/<total>" and "bytes */<total>".
+// start is -1 in the second form and total is -1 when the server sends "*".
+func parseContentRange(value string) (start, total int64, ok bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	total = -1
+	if totalPart != "*" {
+		var err error
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if rangePart == "*" {
+		return -1, total, true
+	}
+	startPart, _, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// parseChecksum returns the hex digest of a "sha256:<hex>" or bare hex checksum
+func parseChecksum(checksum string) (string, error) {
+	digest := strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("checksum must be a SHA-256 digest, optionally prefixed with sha256:")
+	}
+	return digest, nil
+}
+
+// verifyChecksum returns the SHA-256 of a downloaded file, after comparing it
+// with the expected checksum, if any. A file that doesn't match is emptied, so
+// it is fetched whole next time.
+func verifyChecksum(file *os.File, checksum string) (string, error) {
+	var expected []digest.Digest
+	if checksum != "" {
+		parsed, err := digest.ParseSHA256(checksum)
+		if err != nil {
+			return "", err
+		}
+		expected = append(expected, parsed)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	verifier := digest.NewVerifier(expected...)
+	if _, err := io.Copy(verifier, file); err != nil {
+		return "", err
+	}
+	if verifier.Verify() != nil {
+		file.Truncate(0)
+		return "", fmt.Errorf("%w: got %s", ErrChecksumMismatch, verifier.SHA256())
+	}
+	return verifier.SHA256(), nil
+}
+
+// progressWriter writes a download to its file, counting the bytes received
+// and reporting progress at most once per progressInterval
+type progressWriter struct {
+	file     *os.File
+	state    *Progress
+	progress func(Progress)
+	reported time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.state.Received += int64(n)
+	if w.progress != nil && time.Since(w.reported) >= progressInterval {
+		w.progress(*w.state)
+		w.reported = time.Now()
+	}
+	return n, err
+}
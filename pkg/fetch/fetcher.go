@@ -0,0 +1,217 @@
+// Package fetch downloads the remote files of imports without letting a
+// request reach private networks or internal services
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Config controls which URLs a Fetcher may fetch and how long it waits
+type Config struct {
+	AllowedHosts         []string      // when set, only these hosts and their subdomains are fetched
+	DeniedHosts          []string      // hosts and subdomains that are never fetched
+	ConnectTimeout       time.Duration // to connect, including the TLS handshake
+	Timeout              time.Duration // for the whole request, including the body
+	MaxRedirects         int
+	AllowPrivateNetworks bool // reach private, loopback and link-local addresses; for development only
+
+	MaxSize      int64                        // largest file a download may write
+	Retries      int                          // attempts after the first that a download may make
+	RetryBackoff time.Duration                // wait before the first retry, doubled for each one after it
+	Credentials  map[string]map[string]string // named sets of headers, such as Authorization, requests may refer to
+}
+
+// DefaultConfig returns the limits used unless configured otherwise
+func DefaultConfig() Config {
+	return Config{
+		ConnectTimeout: 10 * time.Second,
+		Timeout:        10 * time.Minute,
+		MaxRedirects:   5,
+		MaxSize:        10 * 1024 * 1024 * 1024, // 10GB
+		Retries:        3,
+		RetryBackoff:   time.Second,
+	}
+}
+
+// BlockedError is returned when a URL, one of its redirects or an address its
+// host resolves to is not allowed
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return "remote URL is not allowed: " + e.Reason
+}
+
+// blockedRanges are the networks, beyond what netip classifies as private,
+// loopback or link-local, that a fetch may not reach
+var blockedRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can embed any IPv4 address
+}
+
+// Fetcher fetches remote files over http and https. Every address a host
+// resolves to is checked as the connection is made, so neither a redirect nor
+// a DNS answer that changes between checks can reach a private network.
+type Fetcher struct {
+	config Config
+	client *http.Client
+}
+
+// New creates a fetcher with the given policy
+func New(config Config) *Fetcher {
+	f := &Fetcher{config: config}
+
+	dialer := &net.Dialer{
+		Timeout: config.ConnectTimeout,
+		Control: f.checkAddress,
+	}
+	f.client = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // a proxy would connect on our behalf, past the address check
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   config.ConnectTimeout,
+			ResponseHeaderTimeout: config.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > config.MaxRedirects {
+				return &BlockedError{Reason: fmt.Sprintf("more than %d redirects", config.MaxRedirects)}
+			}
+			if req.URL.Hostname() != via[0].URL.Hostname() {
+				// Credentials are meant for the host they were given for, not wherever it redirects
+				for key := range req.Header {
+					if key != "Range" && key != "If-Range" {
+						req.Header.Del(key)
+					}
+				}
+			}
+			return f.CheckURL(req.URL.String())
+		},
+	}
+	return f
+}
+
+// CheckURL reports whether a URL may be fetched, judging by its scheme and
+// host. Addresses are checked when the host is resolved.
+func (f *Fetcher) CheckURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return &BlockedError{Reason: "it must be an absolute http or https URL"}
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return &BlockedError{Reason: fmt.Sprintf("scheme %q is not http or https", parsed.Scheme)}
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if matchesHost(host, f.config.DeniedHosts) {
+		return &BlockedError{Reason: fmt.Sprintf("host %s is denied", host)}
+	}
+	if len(f.config.AllowedHosts) > 0 && !matchesHost(host, f.config.AllowedHosts) {
+		return &BlockedError{Reason: fmt.Sprintf("host %s is not in the allowlist", host)}
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return f.checkIP(addr)
+	}
+	return nil
+}
+
+// Get fetches a URL after checking it, following allowed redirects only
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	if err := f.CheckURL(rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.client.Do(req)
+}
+
+// Do sends a request other than a download, such as a webhook delivery, under
+// the same policy: its URL is checked, and so is every redirect and address
+func (f *Fetcher) Do(req *http.Request) (*http.Response, error) {
+	if err := f.CheckURL(req.URL.String()); err != nil {
+		return nil, err
+	}
+	return f.client.Do(req)
+}
+
+// checkAddress is the dialer's control hook, which sees the resolved address
+// of every connection just before it is made
+func (f *Fetcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return &BlockedError{Reason: fmt.Sprintf("unexpected address %s", address)}
+	}
+	return f.checkIP(addrPort.Addr())
+}
+
+// checkIP rejects addresses of private, loopback, link-local and other
+// non-public networks, unless the config allows them
+func (f *Fetcher) checkIP(addr netip.Addr) error {
+	if f.config.AllowPrivateNetworks {
+		return nil
+	}
+	addr = addr.Unmap() // an IPv4-mapped IPv6 address reaches the IPv4 one
+
+	var kind string
+	switch {
+	case addr.IsLoopback():
+		kind = "a loopback"
+	case addr.IsPrivate():
+		kind = "a private"
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		kind = "a link-local"
+	case addr.IsUnspecified():
+		kind = "an unspecified"
+	case addr.IsMulticast():
+		kind = "a multicast"
+	default:
+		for _, prefix := range blockedRanges {
+			if prefix.Contains(addr) {
+				kind = "a reserved"
+				break
+			}
+		}
+	}
+	if kind != "" {
+		return &BlockedError{Reason: fmt.Sprintf("%s is %s address", addr, kind)}
+	}
+	return nil
+}
+
+// matchesHost reports whether host is one of hosts or a subdomain of one
+func matchesHost(host string, hosts []string) bool {
+	for _, candidate := range hosts {
+		candidate = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(candidate), "."))
+		if candidate != "" && (host == candidate || strings.HasSuffix(host, "."+candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlocked returns the reason a fetch was blocked, if it was
+func IsBlocked(err error) (string, bool) {
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		return blocked.Reason, true
+	}
+	return "", false
+}
@@ -0,0 +1,211 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckURLRejectsSchemesHostsAndPrivateAddresses(t *testing.T) {
+	config := DefaultConfig()
+	config.DeniedHosts = []string{"internal.example.com"}
+	f := New(config)
+
+	blocked := map[string]string{
+		"ftp://files.example.com/users.csv":          "scheme",
+		"file:///etc/passwd":                         "absolute",
+		"/users.csv":                                 "absolute",
+		"https://internal.example.com/users.csv":     "denied",
+		"https://api.internal.example.com/users.csv": "denied",
+		"http://127.0.0.1/users.csv":                 "loopback",
+		"http://10.1.2.3/users.csv":                  "private",
+		"http://169.254.169.254/latest/meta-data":    "link-local",
+		"http://[::ffff:127.0.0.1]/users.csv":        "loopback",
+		"http://[fd00::1]/users.csv":                 "private",
+		"http://100.64.0.1/users.csv":                "reserved",
+		"http://0.0.0.0:8080/users.csv":              "unspecified",
+	}
+	for rawURL, reason := range blocked {
+		err := f.CheckURL(rawURL)
+		got, ok := IsBlocked(err)
+		if !ok || !strings.Contains(got, reason) {
+			t.Errorf("Expected %s to be blocked as %q, got %v", rawURL, reason, err)
+		}
+	}
+
+	for _, rawURL := range []string{"https://files.example.com/users.csv", "http://93.184.216.34/users.csv"} {
+		if err := f.CheckURL(rawURL); err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", rawURL, err)
+		}
+	}
+
+	config.AllowedHosts = []string{"example.com"}
+	f = New(config)
+	if err := f.CheckURL("https://cdn.example.com/users.csv"); err != nil {
+		t.Errorf("Expected a subdomain of an allowed host to be allowed, got %v", err)
+	}
+	if reason, ok := IsBlocked(f.CheckURL("https://example.org/users.csv")); !ok || !strings.Contains(reason, "allowlist") {
+		t.Errorf("Expected a host outside the allowlist to be blocked, got %q", reason)
+	}
+}
+
+func TestGetChecksResolvedAddressesRedirectsAndTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file.csv":
+			w.Write([]byte("email,name\n"))
+		case "/to-ftp":
+			http.Redirect(w, r, "ftp://files.example.com/file.csv", http.StatusFound)
+		case "/to-localhost":
+			http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/file.csv", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	// localhost is only known to be loopback once it has been resolved
+	local, _ := url.Parse(server.URL)
+	local.Host = "localhost:" + local.Port()
+	if _, err := New(DefaultConfig()).Get(ctx, local.String()+"/file.csv"); err == nil {
+		t.Fatal("Expected a host resolving to loopback to be blocked")
+	} else if reason, ok := IsBlocked(err); !ok || !strings.Contains(reason, "loopback") {
+		t.Errorf("Expected a loopback reason, got %v", err)
+	}
+
+	config := DefaultConfig()
+	config.AllowPrivateNetworks = true // the test server listens on loopback
+	config.AllowedHosts = []string{"127.0.0.1"}
+	config.MaxRedirects = 3
+	config.Timeout = 100 * time.Millisecond
+	f := New(config)
+
+	resp, err := f.Get(ctx, server.URL+"/file.csv")
+	if err != nil {
+		t.Fatalf("Expected an allowed URL to be fetched, got %v", err)
+	}
+	resp.Body.Close()
+
+	for path, reason := range map[string]string{
+		"/to-ftp":       "scheme",
+		"/to-localhost": "allowlist",
+		"/loop":         "more than 3 redirects",
+	} {
+		_, err := f.Get(ctx, server.URL+path)
+		if got, ok := IsBlocked(err); !ok || !strings.Contains(got, reason) {
+			t.Errorf("Expected the redirect from %s to be blocked as %q, got %v", path, reason, err)
+		}
+	}
+
+	if _, err := f.Get(ctx, server.URL+"/slow"); err == nil {
+		t.Error("Expected a slow response to time out")
+	} else if _, blocked := IsBlocked(err); blocked {
+		t.Errorf("Expected a timeout rather than a blocked URL, got %v", err)
+	}
+}
+
+func TestDownloadResumesWithRangeAndVerifiesChecksum(t *testing.T) {
+	content := strings.Repeat("email,name\nann@example.com,Ann\n", 100)
+	sum := sha256.Sum256([]byte(content))
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.csv" {
+			ranges = append(ranges, "missing")
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/corrupt.csv" {
+			ranges = append(ranges, "corrupt")
+			w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+			w.Write([]byte(strings.ToUpper(content)))
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		if len(ranges) == 1 {
+			// Cut the first response off half way
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content[:len(content)/2]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "users.csv", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.AllowPrivateNetworks = true
+	config.RetryBackoff = time.Millisecond
+	f := New(config)
+	path := filepath.Join(t.TempDir(), "users.csv")
+
+	var last Progress
+	req := Request{URL: server.URL + "/users.csv", Checksum: "sha256:" + hex.EncodeToString(sum[:])}
+	sourceDigest, err := f.Download(context.Background(), req, path, func(p Progress) { last = p })
+	if err != nil {
+		t.Fatalf("Expected the download to resume and complete, got %v", err)
+	}
+	if sourceDigest != req.Checksum {
+		t.Errorf("Expected the digest of the whole file, got %s", sourceDigest)
+	}
+	if got, _ := os.ReadFile(path); string(got) != content {
+		t.Fatalf("Expected the resumed file to match, got %d bytes", len(got))
+	}
+	if len(ranges) != 2 || ranges[1] != fmt.Sprintf("bytes=%d-", len(content)/2) {
+		t.Errorf("Expected the second request to ask for the rest, got %q", ranges)
+	}
+	if last.Attempts != 2 || last.Received != int64(len(content)) || last.Validator != `"v1"` {
+		t.Errorf("Expected progress after two attempts, got %+v", last)
+	}
+
+	// A file that doesn't match its checksum is refused and emptied
+	req.Checksum = strings.Repeat("0", 64)
+	os.Remove(path)
+	if _, err := f.Download(context.Background(), req, path, nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("Expected a mismatched file to be emptied, got %d bytes", info.Size())
+	}
+
+	// A response that doesn't match the Content-Digest the server sent is fetched again
+	ranges = nil
+	os.Remove(path)
+	config.Retries = 1
+	if _, err := New(config).Download(context.Background(), Request{URL: server.URL + "/corrupt.csv"}, path, nil); !errors.Is(err, ErrChecksumMismatch) || len(ranges) != 2 {
+		t.Errorf("Expected a digest mismatch after 2 requests, got %v after %d", err, len(ranges))
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("Expected a corrupt response to be discarded, got %d bytes", info.Size())
+	}
+
+	// A client error is not retried
+	ranges = nil
+	_, err = f.Download(context.Background(), Request{URL: server.URL + "/missing.csv"}, path, nil)
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound || len(ranges) != 1 {
+		t.Errorf("Expected one request failing with 404, got %v after %d requests", err, len(ranges))
+	}
+
+	if err := f.ValidateRequest(Request{URL: server.URL, Credential: "partner"}); !errors.Is(err, ErrUnknownCredential) {
+		t.Errorf("Expected an unknown credential to be refused, got %v", err)
+	}
+	if err := f.ValidateRequest(Request{URL: server.URL, Headers: map[string]string{"Range": "bytes=0-"}}); err == nil {
+		t.Error("Expected a reserved header to be refused")
+	}
+}
@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// bundleStages is the order the files of a bundle are imported in, so every
+// foreign key points at a record imported by an earlier stage
+var bundleStages = []string{"users", "articles", "comments"}
+
+// bundleDependencies lists the stages each stage needs to have completed
+var bundleDependencies = map[string][]string{
+	"articles": {"users"},
+	"comments": {"users", "articles"},
+}
+
+// BundleDir returns the directory the files of a bundle archive are unpacked to
+func BundleDir(archivePath string) string {
+	return archivePath + ".d"
+}
+
+// createBundleChildJob creates the import job for one file of a bundle
+func (jm *JobManager) createBundleChildJob(parent *models.ImportJob, file models.BundleFile) *models.ImportJob {
+	job := jm.CreateImportJob(file.ResourceType, file.Format, file.Path)
+
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	child := jm.importJobs[job.ID]
+	child.ParentID = parent.ID
+	child.Options = parent.Options
+	if child.Options.DryRun {
+		child.DryRunResult = &models.DryRunResult{}
+	}
+	jm.persistImportJob(child)
+
+	jobCopy := *child
+	return &jobCopy
+}
+
+// ImportJobChildren returns the per-file jobs of a bundle in import order
+func (jm *JobManager) ImportJobChildren(parentID string) []models.ImportJobSummary {
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	children := make([]models.ImportJobSummary, 0)
+	for _, stage := range bundleStages {
+		for _, job := range jm.importJobs {
+			if job.ParentID == parentID && job.ResourceType == stage {
+				children = append(children, job.Summary())
+			}
+		}
+	}
+	return children
+}
+
+// bundleChild returns the job of a bundle stage, if one was created by an earlier run
+func (jm *JobManager) bundleChild(parentID, stage string) (*models.ImportJob, bool) {
+	jm.mutex.RLock()
+	var id string
+	for _, job := range jm.importJobs {
+		if job.ParentID == parentID && job.ResourceType == stage {
+			id = job.ID
+			break
+		}
+	}
+	jm.mutex.RUnlock()
+
+	if id == "" {
+		return nil, false
+	}
+	return jm.GetImportJob(id)
+}
+
+// refreshBundleJob sums the counters of a bundle's children into the bundle job
+func (jm *JobManager) refreshBundleJob(parentID string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	parent, exists := jm.importJobs[parentID]
+	if !exists {
+		return
+	}
+
+	total, valid, invalid, progress, children := 0, 0, 0, 0, 0
+	dryRun := models.DryRunResult{}
+	for _, job := range jm.importJobs {
+		if job.ParentID != parentID {
+			continue
+		}
+		total += job.TotalRecords
+		valid += job.ValidRecords
+		invalid += job.ErrorRecords
+		progress += job.Progress
+		children++
+		if job.DryRunResult != nil {
+			dryRun.ValidRecords += job.DryRunResult.ValidRecords
+			dryRun.InvalidRecords += job.DryRunResult.InvalidRecords
+			dryRun.WouldCreate += job.DryRunResult.WouldCreate
+			dryRun.WouldUpdate += job.DryRunResult.WouldUpdate
+		}
+	}
+	if children == 0 {
+		return
+	}
+
+	parent.TotalRecords = total
+	parent.ValidRecords = valid
+	parent.ErrorRecords = invalid
+	parent.Progress = min(99, progress/children)
+	if parent.DryRunResult != nil {
+		*parent.DryRunResult = dryRun
+	}
+	jm.persistImportJob(parent)
+	jm.publishImportUpdate(parent, parent.Status, nil)
+}
+
+// processBundle unpacks a bundle and imports its files one stage at a time.
+// A stage whose upstream stage failed or was cancelled is skipped. Resuming a
+// bundle keeps completed stages and resumes the others from their checkpoints.
+func (jp *JobProcessor) processBundle(ctx context.Context, parent *models.ImportJob) {
+	jp.jobManager.UpdateImportJob(parent.ID, "processing", parent.Progress, parent.TotalRecords, parent.ValidRecords, 0, nil)
+
+	files, err := jp.processor.ExtractBundle(parent.FilePath, parent.Format, BundleDir(parent.FilePath))
+	if err != nil {
+		jp.failImportJob(parent.ID, fmt.Sprintf("Bundle import failed: %v", err))
+		return
+	}
+
+	incomplete := make(map[string]bool) // stages that did not complete
+	for _, stage := range bundleStages {
+		var file *models.BundleFile
+		for i := range files {
+			if files[i].ResourceType == stage {
+				file = &files[i]
+			}
+		}
+		if file == nil {
+			continue
+		}
+
+		child, exists := jp.jobManager.bundleChild(parent.ID, stage)
+		if !exists {
+			child = jp.jobManager.createBundleChildJob(parent, *file)
+		}
+		if child.Status == "completed" {
+			continue
+		}
+
+		if blocker := blockingStage(stage, incomplete); blocker != "" {
+			jp.jobManager.UpdateImportJob(child.ID, "cancelled", child.Progress, child.TotalRecords, child.ValidRecords, 0,
+				[]models.ValidationError{{
+					Row:     0,
+					Field:   "general",
+					Message: fmt.Sprintf("Skipped because the %s stage did not complete", blocker),
+				}})
+			incomplete[stage] = true
+			continue
+		}
+
+		// A stage left failed or cancelled by an earlier run continues from its checkpoint
+		if child.Status != "pending" {
+			if child, err = jp.jobManager.ResumeImportJob(child.ID); err != nil {
+				incomplete[stage] = true
+				continue
+			}
+		}
+
+		completed := jp.runImport(ctx, child)
+		jp.jobManager.refreshBundleJob(parent.ID)
+		if ctx.Err() != nil {
+			// The bundle was cancelled or timed out; stop the stage that was running
+			jp.jobManager.CancelImportJob(child.ID)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				jp.failImportJob(parent.ID, "Bundle import timed out")
+			}
+			return
+		}
+		if !completed {
+			incomplete[stage] = true
+		}
+	}
+
+	current, exists := jp.jobManager.GetImportJob(parent.ID)
+	if !exists {
+		return
+	}
+	if len(incomplete) > 0 {
+		stages := make([]string, 0, len(incomplete))
+		for _, stage := range bundleStages {
+			if incomplete[stage] {
+				stages = append(stages, stage)
+			}
+		}
+		jp.failImportJob(parent.ID, fmt.Sprintf("Bundle stages did not complete: %s", strings.Join(stages, ", ")))
+		return
+	}
+
+	jp.jobManager.UpdateImportJob(parent.ID, "completed", 100, current.TotalRecords, current.ValidRecords, 0, nil)
+	os.RemoveAll(BundleDir(parent.FilePath))
+	os.Remove(parent.FilePath)
+}
+
+// blockingStage returns an incomplete stage that stage depends on, or ""
+func blockingStage(stage string, incomplete map[string]bool) string {
+	for _, dependency := range bundleDependencies[stage] {
+		if incomplete[dependency] {
+			return dependency
+		}
+	}
+	return ""
+}
@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+const (
+	// errorSampleSize caps the validation errors kept in memory per import job
+	errorSampleSize = 1000
+	// errorSampleHead is how many of the first errors the sample always keeps;
+	// the rest of the sample holds the most recent errors
+	errorSampleHead = 500
+)
+
+// SetErrorReportDir enables full error reports: every validation error of an
+// import job is appended to an NDJSON file in dir, while the job itself only
+// keeps a sample in memory
+func (jm *JobManager) SetErrorReportDir(dir string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	jm.errorReportDir = dir
+}
+
+// errorReportPath returns the error report file of a job, or "" when reports are disabled
+func (jm *JobManager) errorReportPath(jobID string) string {
+	if jm.errorReportDir == "" {
+		return ""
+	}
+	return filepath.Join(jm.errorReportDir, jobID+".errors.ndjson")
+}
+
+// recordImportErrors counts new errors, spills them to the job's error report
+// and adds them to the in-memory sample; callers must hold the mutex
+func (jm *JobManager) recordImportErrors(job *models.ImportJob, errs []models.ValidationError) {
+	if len(errs) == 0 {
+		return
+	}
+
+	job.ErrorRecords += len(errs)
+	job.Errors = appendErrorSample(job.Errors, errs)
+
+	path := jm.errorReportPath(job.ID)
+	if path == "" {
+		return
+	}
+	if err := appendErrorReport(path, errs); err != nil {
+		log.Printf("Failed to write error report for job %s: %v", job.ID, err)
+	}
+}
+
+// errorReportSize returns the current size of a job's error report; callers must hold the mutex
+func (jm *JobManager) errorReportSize(jobID string) int64 {
+	path := jm.errorReportPath(jobID)
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// rollbackImportErrors drops the errors recorded after a checkpoint; callers must hold the mutex
+func (jm *JobManager) rollbackImportErrors(job *models.ImportJob, checkpoint models.ImportCheckpoint) {
+	rolledBack := job.ErrorRecords - checkpoint.ErrorCount
+	job.ErrorRecords = checkpoint.ErrorCount
+
+	path := jm.errorReportPath(job.ID)
+	if path == "" {
+		// The rolled back errors are the newest, at the end of the sample. A
+		// trimmed sample still starts with the first errors, which came before.
+		keep := max(len(job.Errors)-rolledBack, min(checkpoint.ErrorCount, errorSampleHead))
+		job.Errors = job.Errors[:min(keep, len(job.Errors))]
+		return
+	}
+
+	if err := os.Truncate(path, checkpoint.ErrorReportOffset); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to roll back error report for job %s: %v", job.ID, err)
+	}
+
+	// Rebuild the sample from the report, since its tail may hold rolled back
+	// errors, reading it a sample's worth at a time
+	sample := make([]models.ValidationError, 0)
+	batch := make([]models.ValidationError, 0, errorSampleSize)
+	err := readErrorReport(path, func(e models.ValidationError) error {
+		if batch = append(batch, e); len(batch) == errorSampleSize {
+			sample = appendErrorSample(sample, batch)
+			batch = batch[:0]
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to read error report for job %s: %v", job.ID, err)
+		return
+	}
+	job.Errors = appendErrorSample(sample, batch)
+}
+
+// WriteImportErrorReport writes every validation error of an import job to w
+// as "csv" or "ndjson". Without an error report directory, only the in-memory
+// sample can be written.
+func (jm *JobManager) WriteImportErrorReport(id, format string, w io.Writer) error {
+	job, exists := jm.GetImportJob(id)
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	jm.mutex.RLock()
+	path := jm.errorReportPath(id)
+	jm.mutex.RUnlock()
+
+	var csvWriter *csv.Writer
+	if format == "csv" {
+		csvWriter = csv.NewWriter(w)
+		defer csvWriter.Flush()
+		if err := csvWriter.Write([]string{"row", "field", "value", "message"}); err != nil {
+			return err
+		}
+	}
+
+	write := func(e models.ValidationError) error {
+		if csvWriter != nil {
+			value := ""
+			if e.Value != nil {
+				value = fmt.Sprint(e.Value)
+			}
+			return csvWriter.Write([]string{strconv.Itoa(e.Row), e.Field, value, e.Message})
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(line))
+		return err
+	}
+
+	if path == "" {
+		for _, e := range job.Errors {
+			if err := write(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := readErrorReport(path, write)
+	if os.IsNotExist(err) {
+		// No errors were reported
+		return nil
+	}
+	return err
+}
+
+// removeErrorReport deletes the error report of a job; callers must hold the mutex
+func (jm *JobManager) removeErrorReport(jobID string) {
+	if path := jm.errorReportPath(jobID); path != "" {
+		os.Remove(path)
+	}
+}
+
+// appendErrorSample adds errors to a bounded sample that keeps the first
+// errorSampleHead errors and the most recent ones after them. The tail is
+// trimmed once per call, so callers should add errors a batch at a time.
+func appendErrorSample(sample, errs []models.ValidationError) []models.ValidationError {
+	sample = append(sample, errs...)
+	if len(sample) <= errorSampleSize {
+		return sample
+	}
+	copy(sample[errorSampleHead:], sample[len(sample)-(errorSampleSize-errorSampleHead):])
+	return sample[:errorSampleSize]
+}
+
+// appendErrorReport appends errors to an NDJSON report file
+func appendErrorReport(path string, errs []models.ValidationError) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, e := range errs {
+		if err := encoder.Encode(e); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readErrorReport calls fn for every error in an NDJSON report file. A
+// partially written last line is ignored.
+func readErrorReport(path string, fn func(models.ValidationError) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var e models.ValidationError
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("corrupt error report: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
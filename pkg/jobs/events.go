@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"sync"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+const (
+	// EventProgress carries the job's status, progress and counters
+	EventProgress = "progress"
+	// EventErrors carries validation errors reported since the previous event
+	EventErrors = "errors"
+	// EventStatus is sent when a job changes status, including its final status
+	EventStatus = "status"
+
+	// eventHistorySize is how many events are kept per job for Last-Event-ID replay
+	eventHistorySize = 256
+	// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+	subscriberBuffer = 64
+)
+
+// JobEvent is a change to a job pushed to live subscribers
+type JobEvent struct {
+	ID   int64       `json:"id"` // increases by one per job, used as the SSE event ID
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// IsFinal reports whether the event carries a terminal job status
+func (e JobEvent) IsFinal() bool {
+	if e.Type != EventStatus {
+		return false
+	}
+	switch data := e.Data.(type) {
+	case models.ImportJobSummary:
+		return isTerminalStatus(data.Status)
+	case models.ExportJobSummary:
+		return isTerminalStatus(data.Status)
+	}
+	return false
+}
+
+// jobEventLog holds the recent events of one job and its live subscribers
+type jobEventLog struct {
+	lastID      int64
+	history     []JobEvent
+	subscribers map[chan JobEvent]struct{}
+}
+
+// eventHub fans job events out to subscribers and keeps a short history
+type eventHub struct {
+	logs  map[string]*jobEventLog
+	mutex sync.Mutex
+}
+
+// newEventHub creates an empty event hub
+func newEventHub() *eventHub {
+	return &eventHub{
+		logs: make(map[string]*jobEventLog),
+	}
+}
+
+// log returns the event log of a job, creating it if needed; callers must hold the mutex
+func (h *eventHub) log(jobID string) *jobEventLog {
+	l, exists := h.logs[jobID]
+	if !exists {
+		l = &jobEventLog{subscribers: make(map[chan JobEvent]struct{})}
+		h.logs[jobID] = l
+	}
+	return l
+}
+
+// publish records an event and sends it to every subscriber of the job. It
+// never blocks: a subscriber whose buffer is full is dropped and its channel
+// closed, so the client reconnects and catches up from the history.
+func (h *eventHub) publish(jobID, eventType string, data interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	l := h.log(jobID)
+	l.lastID++
+	event := JobEvent{ID: l.lastID, Type: eventType, Data: data}
+
+	l.history = append(l.history, event)
+	if len(l.history) > eventHistorySize {
+		l.history = l.history[len(l.history)-eventHistorySize:]
+	}
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(l.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the events after lastEventID that are still in the
+// history, and a channel receiving every later event
+func (h *eventHub) subscribe(jobID string, lastEventID int64) ([]JobEvent, <-chan JobEvent, func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	l := h.log(jobID)
+	var missed []JobEvent
+	for _, event := range l.history {
+		if event.ID > lastEventID {
+			missed = append(missed, event)
+		}
+	}
+
+	ch := make(chan JobEvent, subscriberBuffer)
+	l.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		if _, subscribed := l.subscribers[ch]; subscribed {
+			delete(l.subscribers, ch)
+			close(ch)
+		}
+	}
+	return missed, ch, unsubscribe
+}
+
+// remove drops the event log of a job and disconnects its subscribers
+func (h *eventHub) remove(jobID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if l, exists := h.logs[jobID]; exists {
+		for ch := range l.subscribers {
+			delete(l.subscribers, ch)
+			close(ch)
+		}
+		delete(h.logs, jobID)
+	}
+}
+
+// SubscribeImportJob streams the events of an import job. Events after
+// lastEventID still in the history are returned first; the channel then
+// receives live events. The returned function must be called to unsubscribe.
+func (jm *JobManager) SubscribeImportJob(id string, lastEventID int64) ([]JobEvent, <-chan JobEvent, func(), error) {
+	if _, exists := jm.GetImportJob(id); !exists {
+		return nil, nil, nil, ErrJobNotFound
+	}
+	missed, ch, unsubscribe := jm.events.subscribe(id, lastEventID)
+	return missed, ch, unsubscribe, nil
+}
+
+// SubscribeExportJob streams the events of an export job, like SubscribeImportJob
+func (jm *JobManager) SubscribeExportJob(id string, lastEventID int64) ([]JobEvent, <-chan JobEvent, func(), error) {
+	if _, exists := jm.GetExportJob(id); !exists {
+		return nil, nil, nil, ErrJobNotFound
+	}
+	missed, ch, unsubscribe := jm.events.subscribe(id, lastEventID)
+	return missed, ch, unsubscribe, nil
+}
+
+// publishImportUpdate emits the events for a change to an import job; callers must hold the mutex
+func (jm *JobManager) publishImportUpdate(job *models.ImportJob, previousStatus string, newErrors []models.ValidationError) {
+	if len(newErrors) > 0 {
+		jm.events.publish(job.ID, EventErrors, newErrors)
+	}
+	if job.Status != previousStatus {
+		jm.events.publish(job.ID, EventStatus, job.Summary())
+		return
+	}
+	jm.events.publish(job.ID, EventProgress, job.Summary())
+}
+
+// publishExportUpdate emits the events for a change to an export job; callers must hold the mutex
+func (jm *JobManager) publishExportUpdate(job *models.ExportJob, previousStatus string) {
+	if job.Status != previousStatus {
+		jm.events.publish(job.ID, EventStatus, job.Summary())
+		return
+	}
+	jm.events.publish(job.ID, EventProgress, job.Summary())
+}
@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// DefaultIdempotencyTTL is how long an idempotency key is remembered by default
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned when a key comes back with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+// IdempotencyManager remembers which job each Idempotency-Key created, so a
+// retried request returns the original job instead of starting another one
+type IdempotencyManager struct {
+	keys  map[string]*models.IdempotencyKey // scope + key -> record
+	store IdempotencyStore                  // optional; nil keeps keys in memory only
+	ttl   time.Duration
+	mutex sync.RWMutex
+}
+
+// NewIdempotencyManager creates an in-memory idempotency manager whose keys expire after ttl
+func NewIdempotencyManager(ttl time.Duration) *IdempotencyManager {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyManager{
+		keys: make(map[string]*models.IdempotencyKey),
+		ttl:  ttl,
+	}
+}
+
+// NewIdempotencyManagerWithStore creates an idempotency manager backed by a
+// persistent store, loading the keys that have not expired yet
+func NewIdempotencyManagerWithStore(store IdempotencyStore, ttl time.Duration) (*IdempotencyManager, error) {
+	im := NewIdempotencyManager(ttl)
+	im.store = store
+
+	keys, err := store.LoadIdempotencyKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load idempotency keys: %w", err)
+	}
+
+	cutoff := time.Now().Add(-im.ttl)
+	for _, key := range keys {
+		if key.CreatedAt.After(cutoff) {
+			im.keys[idempotencyMapKey(key.Scope, key.Key)] = key
+		}
+	}
+	return im, nil
+}
+
+// RequestFingerprint hashes the parts that identify a request, such as its
+// resource type, format and file checksum
+func RequestFingerprint(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		// Length-prefix each part so ("ab", "c") and ("a", "bc") differ
+		fmt.Fprintf(hash, "%d:%s;", len(part), part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CheckIdempotency returns the job created for a key within scope. It returns
+// ErrIdempotencyKeyReused when the key was used with a different fingerprint.
+func (im *IdempotencyManager) CheckIdempotency(scope, key, fingerprint string) (string, bool, error) {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	record, exists := im.keys[idempotencyMapKey(scope, key)]
+	if !exists || im.expired(record) {
+		return "", false, nil
+	}
+	if record.Fingerprint != fingerprint {
+		return "", false, ErrIdempotencyKeyReused
+	}
+	return record.JobID, true, nil
+}
+
+// SetIdempotency stores the job created for a key and request fingerprint
+func (im *IdempotencyManager) SetIdempotency(scope, key, fingerprint, jobID string) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	record := &models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		JobID:       jobID,
+		CreatedAt:   time.Now(),
+	}
+	im.keys[idempotencyMapKey(scope, key)] = record
+
+	if im.store != nil {
+		if err := im.store.SaveIdempotencyKey(record); err != nil {
+			log.Printf("Failed to persist idempotency key for job %s: %v", jobID, err)
+		}
+	}
+}
+
+// CleanupIdempotencyKeys removes keys older than the TTL
+func (im *IdempotencyManager) CleanupIdempotencyKeys() {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	for mapKey, record := range im.keys {
+		if im.expired(record) {
+			delete(im.keys, mapKey)
+		}
+	}
+
+	if im.store != nil {
+		if err := im.store.DeleteIdempotencyKeysBefore(time.Now().Add(-im.ttl)); err != nil {
+			log.Printf("Failed to delete expired idempotency keys from store: %v", err)
+		}
+	}
+}
+
+// expired reports whether a key has outlived the TTL; callers must hold the mutex
+func (im *IdempotencyManager) expired(record *models.IdempotencyKey) bool {
+	return time.Since(record.CreatedAt) > im.ttl
+}
+
+// idempotencyMapKey keeps import and export keys apart
+func idempotencyMapKey(scope, key string) string {
+	return scope + "/" + key
+}
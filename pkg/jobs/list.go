@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+const (
+	// DefaultListLimit is the page size used when none is requested
+	DefaultListLimit = 50
+	// MaxListLimit caps the page size a client may request
+	MaxListLimit = 500
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions filters, sorts and paginates job listings
+type ListOptions struct {
+	Status        string
+	ResourceType  string
+	FileName      string // case-insensitive substring match
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string // created_at, status, resource_type or file_name; prefix with - for descending
+	Limit         int
+	Cursor        string
+}
+
+// sortableFields lists the fields a job listing can be sorted by
+var sortableFields = map[string]bool{
+	"created_at":    true,
+	"status":        true,
+	"resource_type": true,
+	"file_name":     true,
+}
+
+// listCursor marks the last item of a page
+type listCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+// listEntry is a job reduced to what filtering and ordering need
+type listEntry struct {
+	id  string
+	key string
+}
+
+// Normalize applies defaults and validates the sort field
+func (o *ListOptions) Normalize() error {
+	if o.Sort == "" {
+		o.Sort = "-created_at"
+	}
+	if !sortableFields[strings.TrimPrefix(o.Sort, "-")] {
+		return fmt.Errorf("unsupported sort field: %s", strings.TrimPrefix(o.Sort, "-"))
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+	return nil
+}
+
+// matches reports whether a job passes the filters
+func (o *ListOptions) matches(status, resourceType, fileName string, createdAt time.Time) bool {
+	if o.Status != "" && status != o.Status {
+		return false
+	}
+	if o.ResourceType != "" && resourceType != o.ResourceType {
+		return false
+	}
+	if o.FileName != "" && !strings.Contains(strings.ToLower(fileName), strings.ToLower(o.FileName)) {
+		return false
+	}
+	if o.CreatedAfter != nil && createdAt.Before(*o.CreatedAfter) {
+		return false
+	}
+	if o.CreatedBefore != nil && !createdAt.Before(*o.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// sortKey builds a key that orders jobs by the sort field, then by creation time
+func (o *ListOptions) sortKey(status, resourceType, fileName string, createdAt time.Time) string {
+	created := createdAt.UTC().Format("2006-01-02T15:04:05.000000000")
+	switch strings.TrimPrefix(o.Sort, "-") {
+	case "status":
+		return status + "\x00" + created
+	case "resource_type":
+		return resourceType + "\x00" + created
+	case "file_name":
+		return fileName + "\x00" + created
+	default:
+		return created
+	}
+}
+
+// paginate orders entries and returns the IDs of the requested page and the cursor of the next one
+func (o *ListOptions) paginate(entries []listEntry) ([]string, string, error) {
+	descending := strings.HasPrefix(o.Sort, "-")
+	less := func(a, b listEntry) bool {
+		if a.key != b.key {
+			return (a.key < b.key) != descending
+		}
+		if a.id != b.id {
+			return (a.id < b.id) != descending
+		}
+		return false
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+
+	start := 0
+	if o.Cursor != "" {
+		after, err := decodeCursor(o.Cursor, o.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		start = sort.Search(len(entries), func(i int) bool { return less(after, entries[i]) })
+	}
+
+	end := min(start+o.Limit, len(entries))
+	ids := make([]string, 0, end-start)
+	for _, entry := range entries[start:end] {
+		ids = append(ids, entry.id)
+	}
+
+	nextCursor := ""
+	if end < len(entries) {
+		nextCursor = encodeCursor(listCursor{Sort: o.Sort, Key: entries[end-1].key, ID: entries[end-1].id})
+	}
+	return ids, nextCursor, nil
+}
+
+// encodeCursor serializes a cursor into an opaque token
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor token and checks it belongs to the same sort order
+func decodeCursor(token, sortOrder string) (listEntry, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return listEntry{}, ErrInvalidCursor
+	}
+
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sortOrder {
+		return listEntry{}, ErrInvalidCursor
+	}
+	return listEntry{id: cursor.ID, key: cursor.Key}, nil
+}
+
+// ListImportJobs returns summaries of the import jobs matching the options,
+// together with the cursor of the next page (empty on the last page)
+func (jm *JobManager) ListImportJobs(opts ListOptions) ([]models.ImportJobSummary, string, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, "", err
+	}
+
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	var entries []listEntry
+	for _, job := range jm.importJobs {
+		if opts.matches(job.Status, job.ResourceType, job.FileName, job.CreatedAt) {
+			entries = append(entries, listEntry{
+				id:  job.ID,
+				key: opts.sortKey(job.Status, job.ResourceType, job.FileName, job.CreatedAt),
+			})
+		}
+	}
+
+	ids, nextCursor, err := opts.paginate(entries)
+	if err != nil {
+		return nil, "", err
+	}
+
+	summaries := make([]models.ImportJobSummary, 0, len(ids))
+	for _, id := range ids {
+		summaries = append(summaries, jm.importJobs[id].Summary())
+	}
+	return summaries, nextCursor, nil
+}
+
+// ListExportJobs returns summaries of the export jobs matching the options,
+// together with the cursor of the next page (empty on the last page). The
+// file name of an export is the name of its download file.
+func (jm *JobManager) ListExportJobs(opts ListOptions) ([]models.ExportJobSummary, string, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, "", err
+	}
+
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	var entries []listEntry
+	for _, job := range jm.exportJobs {
+		fileName := job.FileName()
+		if opts.matches(job.Status, job.ResourceType, fileName, job.CreatedAt) {
+			entries = append(entries, listEntry{
+				id:  job.ID,
+				key: opts.sortKey(job.Status, job.ResourceType, fileName, job.CreatedAt),
+			})
+		}
+	}
+
+	ids, nextCursor, err := opts.paginate(entries)
+	if err != nil {
+		return nil, "", err
+	}
+
+	summaries := make([]models.ExportJobSummary, 0, len(ids))
+	for _, id := range ids {
+		summaries = append(summaries, jm.exportJobs[id].Summary())
+	}
+	return summaries, nextCursor, nil
+}
@@ -1,356 +1,1040 @@
-package jobs
-
-import (
-	"context"
-	"fmt"
-	"sync"
-	"time"
-
-	"github.com/google/uuid"
-	"github.com/vairarchi/bulk-import-export-api/internal/models"
-)
-
-// JobManager handles asynchronous job processing
-type JobManager struct {
-	importJobs map[string]*models.ImportJob
-	exportJobs map[string]*models.ExportJob
-	mutex      sync.RWMutex
-}
-
-// NewJobManager creates a new job manager
-func NewJobManager() *JobManager {
-	return &JobManager{
-		importJobs: make(map[string]*models.ImportJob),
-		exportJobs: make(map[string]*models.ExportJob),
-	}
-}
-
-// CreateImportJob creates a new import job
-func (jm *JobManager) CreateImportJob(resourceType, fileName string) *models.ImportJob {
-	jm.mutex.Lock()
-	defer jm.mutex.Unlock()
-
-	job := &models.ImportJob{
-		ID:           uuid.New().String(),
-		Status:       "pending",
-		ResourceType: resourceType,
-		FileName:     fileName,
-		TotalRecords: 0,
-		ValidRecords: 0,
-		ErrorRecords: 0,
-		Errors:       make([]models.ValidationError, 0),
-		CreatedAt:    time.Now(),
-		Progress:     0,
-	}
-
-	jm.importJobs[job.ID] = job
-	return job
-}
-
-// CreateExportJob creates a new export job
-func (jm *JobManager) CreateExportJob(resourceType, format string, filters map[string]string) *models.ExportJob {
-	jm.mutex.Lock()
-	defer jm.mutex.Unlock()
-
-	job := &models.ExportJob{
-		ID:           uuid.New().String(),
-		Status:       "pending",
-		ResourceType: resourceType,
-		Format:       format,
-		Filters:      filters,
-		TotalRecords: 0,
-		CreatedAt:    time.Now(),
-		Progress:     0,
-	}
-
-	jm.exportJobs[job.ID] = job
-	return job
-}
-
-// GetImportJob retrieves an import job by ID
-func (jm *JobManager) GetImportJob(id string) (*models.ImportJob, bool) {
-	jm.mutex.RLock()
-	defer jm.mutex.RUnlock()
-
-	job, exists := jm.importJobs[id]
-	if !exists {
-		return nil, false
-	}
-
-	// Return a copy to avoid concurrent modification
-	jobCopy := *job
-	jobCopy.Errors = make([]models.ValidationError, len(job.Errors))
-	copy(jobCopy.Errors, job.Errors)
-
-	return &jobCopy, true
-}
-
-// GetExportJob retrieves an export job by ID
-func (jm *JobManager) GetExportJob(id string) (*models.ExportJob, bool) {
-	jm.mutex.RLock()
-	defer jm.mutex.RUnlock()
-
-	job, exists := jm.exportJobs[id]
-	if !exists {
-		return nil, false
-	}
-
-	// Return a copy to avoid concurrent modification
-	jobCopy := *job
-	return &jobCopy, true
-}
-
-// UpdateImportJob updates the status and progress of an import job
-func (jm *JobManager) UpdateImportJob(id string, status string, progress int, totalRecords, validRecords, errorRecords int, errors []models.ValidationError) {
-	jm.mutex.Lock()
-	defer jm.mutex.Unlock()
-
-	if job, exists := jm.importJobs[id]; exists {
-		job.Status = status
-		job.Progress = progress
-		job.TotalRecords = totalRecords
-		job.ValidRecords = validRecords
-
-		// Append new errors (limit to prevent memory issues)
-		maxErrors := 1000
-		if len(job.Errors)+len(errors) > maxErrors {
-			// Keep the first 500 and last 500 errors
-			if len(job.Errors) < 500 {
-				remainingSlots := 500 - len(job.Errors)
-				job.Errors = append(job.Errors, errors[:min(remainingSlots, len(errors))]...)
-			}
-			// Add latest errors, keeping only the most recent 500
-			if len(errors) > 500 {
-				job.Errors = append(job.Errors[:500], errors[len(errors)-500:]...)
-			} else {
-				job.Errors = append(job.Errors[:500], errors...)
-			}
-		} else {
-			job.Errors = append(job.Errors, errors...)
-		}
-
-		// Set error count based on actual accumulated errors
-		job.ErrorRecords = len(job.Errors)
-
-		if status == "completed" || status == "failed" {
-			now := time.Now()
-			job.CompletedAt = &now
-		}
-	}
-}
-
-// UpdateExportJob updates the status and progress of an export job
-func (jm *JobManager) UpdateExportJob(id string, status string, progress int, totalRecords int, downloadURL string) {
-	jm.mutex.Lock()
-	defer jm.mutex.Unlock()
-
-	if job, exists := jm.exportJobs[id]; exists {
-		job.Status = status
-		job.Progress = progress
-		job.TotalRecords = totalRecords
-		job.DownloadURL = downloadURL
-
-		if status == "completed" || status == "failed" {
-			now := time.Now()
-			job.CompletedAt = &now
-		}
-	}
-}
-
-// JobProcessor handles the actual processing of jobs
-type JobProcessor struct {
-	jobManager *JobManager
-	storage    Storage
-	processor  DataProcessor
-}
-
-// Storage interface for job processing
-type Storage interface {
-	BatchInsertUsers(users []models.User) error
-	BatchInsertArticles(articles []models.Article) error
-	BatchInsertComments(comments []models.Comment) error
-	CountUsers(filters map[string]string) (int, error)
-	CountArticles(filters map[string]string) (int, error)
-	CountComments(filters map[string]string) (int, error)
-}
-
-// DataProcessor interface for processing import/export data
-type DataProcessor interface {
-	ProcessImport(ctx context.Context, jobID string, resourceType string, filePath string, format string) error
-	ProcessExport(ctx context.Context, jobID string, resourceType string, format string, filters map[string]string) (string, error)
-}
-
-// NewJobProcessor creates a new job processor
-func NewJobProcessor(jobManager *JobManager, storage Storage, processor DataProcessor) *JobProcessor {
-	return &JobProcessor{
-		jobManager: jobManager,
-		storage:    storage,
-		processor:  processor,
-	}
-}
-
-// ProcessImportJob processes an import job asynchronously
-func (jp *JobProcessor) ProcessImportJob(ctx context.Context, jobID string, filePath string, format string) {
-	go func() {
-		// Create a timeout context for this specific job
-		jobCtx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
-
-		job, exists := jp.jobManager.GetImportJob(jobID)
-		if !exists {
-			return
-		}
-
-		// Mark job as processing
-		jp.jobManager.UpdateImportJob(jobID, "processing", 0, 0, 0, 0, nil)
-
-		// Process the import
-		err := jp.processor.ProcessImport(jobCtx, jobID, job.ResourceType, filePath, format)
-
-		if err != nil {
-			jp.jobManager.UpdateImportJob(jobID, "failed", 100, 0, 0, 0,
-				[]models.ValidationError{{
-					Row:     0,
-					Field:   "general",
-					Message: fmt.Sprintf("Import failed: %v", err),
-				}})
-		}
-	}()
-}
-
-// ProcessExportJob processes an export job asynchronously
-func (jp *JobProcessor) ProcessExportJob(ctx context.Context, jobID string) {
-	go func() {
-		// Create a timeout context for this specific job
-		jobCtx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
-
-		job, exists := jp.jobManager.GetExportJob(jobID)
-		if !exists {
-			return
-		}
-
-		// Mark job as processing
-		jp.jobManager.UpdateExportJob(jobID, "processing", 0, 0, "")
-
-		// Get total count
-		var totalRecords int
-		var err error
-
-		switch job.ResourceType {
-		case "users":
-			totalRecords, err = jp.storage.CountUsers(job.Filters)
-		case "articles":
-			totalRecords, err = jp.storage.CountArticles(job.Filters)
-		case "comments":
-			totalRecords, err = jp.storage.CountComments(job.Filters)
-		default:
-			err = fmt.Errorf("unknown resource type: %s", job.ResourceType)
-		}
-
-		if err != nil {
-			jp.jobManager.UpdateExportJob(jobID, "failed", 100, 0, "")
-			return
-		}
-
-		// Process the export
-		downloadURL, err := jp.processor.ProcessExport(jobCtx, jobID, job.ResourceType, job.Format, job.Filters)
-
-		if err != nil {
-			jp.jobManager.UpdateExportJob(jobID, "failed", 100, totalRecords, "")
-		} else {
-			jp.jobManager.UpdateExportJob(jobID, "completed", 100, totalRecords, downloadURL)
-		}
-	}()
-}
-
-// CleanupOldJobs removes jobs older than the specified duration
-func (jm *JobManager) CleanupOldJobs(maxAge time.Duration) {
-	jm.mutex.Lock()
-	defer jm.mutex.Unlock()
-
-	cutoff := time.Now().Add(-maxAge)
-
-	// Clean up import jobs
-	for id, job := range jm.importJobs {
-		if job.CreatedAt.Before(cutoff) {
-			delete(jm.importJobs, id)
-		}
-	}
-
-	// Clean up export jobs
-	for id, job := range jm.exportJobs {
-		if job.CreatedAt.Before(cutoff) {
-			delete(jm.exportJobs, id)
-		}
-	}
-}
-
-// GetJobStats returns statistics about running jobs
-func (jm *JobManager) GetJobStats() map[string]interface{} {
-	jm.mutex.RLock()
-	defer jm.mutex.RUnlock()
-
-	importStats := make(map[string]int)
-	exportStats := make(map[string]int)
-
-	for _, job := range jm.importJobs {
-		importStats[job.Status]++
-	}
-
-	for _, job := range jm.exportJobs {
-		exportStats[job.Status]++
-	}
-
-	return map[string]interface{}{
-		"import_jobs":       importStats,
-		"export_jobs":       exportStats,
-		"total_import_jobs": len(jm.importJobs),
-		"total_export_jobs": len(jm.exportJobs),
-	}
-}
-
-// Helper function for min
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// IdempotencyManager handles idempotency for import requests
-type IdempotencyManager struct {
-	keys  map[string]string // idempotency-key -> job-id
-	mutex sync.RWMutex
-}
-
-// NewIdempotencyManager creates a new idempotency manager
-func NewIdempotencyManager() *IdempotencyManager {
-	return &IdempotencyManager{
-		keys: make(map[string]string),
-	}
-}
-
-// CheckIdempotency checks if a request with the given key has been processed
-func (im *IdempotencyManager) CheckIdempotency(key string) (string, bool) {
-	im.mutex.RLock()
-	defer im.mutex.RUnlock()
-
-	jobID, exists := im.keys[key]
-	return jobID, exists
-}
-
-// SetIdempotency stores the mapping of idempotency key to job ID
-func (im *IdempotencyManager) SetIdempotency(key, jobID string) {
-	im.mutex.Lock()
-	defer im.mutex.Unlock()
-
-	im.keys[key] = jobID
-}
-
-// CleanupIdempotencyKeys removes old idempotency keys
-func (im *IdempotencyManager) CleanupIdempotencyKeys(maxAge time.Duration) {
-	// In a real implementation, you'd store timestamps with the keys
-	// and clean them up based on age. For simplicity, we'll skip this
-	// or implement a simple LRU-based cleanup.
-}
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/fetch"
+	"github.com/vairarchi/bulk-import-export-api/pkg/s3"
+)
+
+var (
+	// ErrJobNotFound is returned when a job ID is unknown
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when an operation requires a job that is still running
+	ErrJobFinished = errors.New("job has already finished")
+	// ErrJobNotResumable is returned when resuming a job that is not failed or cancelled
+	ErrJobNotResumable = errors.New("only failed or cancelled jobs can be resumed")
+	// ErrSourceFileMissing is returned when the source file of a job is no longer on disk
+	ErrSourceFileMissing = errors.New("source file is no longer available")
+	// ErrProfileNotFound is returned when a mapping profile name is unknown
+	ErrProfileNotFound = errors.New("mapping profile not found")
+)
+
+// maxImportWarnings caps the warnings kept for an import job
+const maxImportWarnings = 50
+
+// isTerminalStatus reports whether a job status is final
+func isTerminalStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled"
+}
+
+// JobNotifier is told when a job reaches a terminal status. It is called
+// while the manager holds its lock, so implementations must not block.
+type JobNotifier interface {
+	ImportJobFinished(job models.ImportJob)
+	ExportJobFinished(job models.ExportJob)
+}
+
+// JobManager handles asynchronous job processing
+type JobManager struct {
+	importJobs map[string]*models.ImportJob
+	exportJobs map[string]*models.ExportJob
+	store      JobStore    // optional; nil keeps jobs in memory only
+	notifier   JobNotifier // optional; told about finished jobs
+	events     *eventHub
+	mutex      sync.RWMutex
+
+	errorReportDir string // optional; where full error reports of import jobs are written
+}
+
+// NewJobManager creates a new in-memory job manager
+func NewJobManager() *JobManager {
+	return &JobManager{
+		importJobs: make(map[string]*models.ImportJob),
+		exportJobs: make(map[string]*models.ExportJob),
+		events:     newEventHub(),
+	}
+}
+
+// NewJobManagerWithStore creates a job manager backed by a persistent store.
+// Jobs already in the store are loaded; once the manager is configured,
+// RecoverInterruptedJobs fails those the previous process left unfinished.
+func NewJobManagerWithStore(store JobStore) (*JobManager, error) {
+	jm := NewJobManager()
+	jm.store = store
+
+	importJobs, err := store.LoadImportJobs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import jobs: %w", err)
+	}
+	exportJobs, err := store.LoadExportJobs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load export jobs: %w", err)
+	}
+
+	for _, job := range importJobs {
+		if job.Errors == nil {
+			job.Errors = make([]models.ValidationError, 0)
+		}
+		jm.importJobs[job.ID] = job
+	}
+	for _, job := range exportJobs {
+		jm.exportJobs[job.ID] = job
+	}
+
+	return jm, nil
+}
+
+// SetNotifier registers the notifier told about jobs reaching a terminal status
+func (jm *JobManager) SetNotifier(notifier JobNotifier) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	jm.notifier = notifier
+}
+
+// SetImportCallback sets the webhook called when an import job finishes
+func (jm *JobManager) SetImportCallback(id, url, secret string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists {
+		job.CallbackURL = url
+		job.CallbackSecret = secret
+		jm.persistImportJob(job)
+	}
+}
+
+// SetExportCallback sets the webhook called when an export job finishes
+func (jm *JobManager) SetExportCallback(id, url, secret string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.exportJobs[id]; exists {
+		job.CallbackURL = url
+		job.CallbackSecret = secret
+		jm.persistExportJob(job)
+	}
+}
+
+// SetExportDestination sets where an export job writes its file, instead of
+// the server's default
+func (jm *JobManager) SetExportDestination(id, destination string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.exportJobs[id]; exists {
+		job.Destination = destination
+		jm.persistExportJob(job)
+	}
+}
+
+// SetImportFilePath records the file a streamed import job was spooled to,
+// which it can be resumed from
+func (jm *JobManager) SetImportFilePath(id, filePath string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists {
+		job.FilePath = filePath
+		jm.persistImportJob(job)
+	}
+}
+
+// SetImportSourceDigest records the digest of the file an import job reads,
+// so the job can be tied to its exact input
+func (jm *JobManager) SetImportSourceDigest(id, sourceDigest string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists {
+		job.SourceDigest = sourceDigest
+		jm.persistImportJob(job)
+	}
+}
+
+// SetImportOptions sets the options an import job runs with
+func (jm *JobManager) SetImportOptions(id string, options models.ImportOptions) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists {
+		job.Options = options
+		if options.DryRun {
+			job.DryRunResult = &models.DryRunResult{}
+		}
+		jm.persistImportJob(job)
+	}
+}
+
+// notifyImportFinished tells the notifier about a finished import; callers must hold the mutex
+func (jm *JobManager) notifyImportFinished(job *models.ImportJob) {
+	if jm.notifier == nil {
+		return
+	}
+	jobCopy := *job
+	jobCopy.Errors = nil
+	jm.notifier.ImportJobFinished(jobCopy)
+}
+
+// notifyExportFinished tells the notifier about a finished export; callers must hold the mutex
+func (jm *JobManager) notifyExportFinished(job *models.ExportJob) {
+	if jm.notifier == nil {
+		return
+	}
+	jm.notifier.ExportJobFinished(*job)
+}
+
+// RecoverInterruptedJobs moves jobs left unfinished by a previous process to a
+// terminal state. It is called after the error report dir and notifier are
+// set, so the error it records reaches the job's report and the failure is
+// delivered to the job's callback.
+func (jm *JobManager) RecoverInterruptedJobs() {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	now := time.Now()
+	recovered := 0
+
+	for _, job := range jm.importJobs {
+		if job.Status != "pending" && job.Status != "downloading" && job.Status != "processing" {
+			continue
+		}
+		job.Status = "failed"
+		job.CompletedAt = &now
+		jm.recordImportErrors(job, []models.ValidationError{{
+			Row:     0,
+			Field:   "general",
+			Message: "Import interrupted by server restart; resume it to continue from the last checkpoint",
+		}})
+		jm.persistImportJob(job)
+		jm.notifyImportFinished(job)
+		recovered++
+	}
+
+	for _, job := range jm.exportJobs {
+		if job.Status != "pending" && job.Status != "processing" {
+			continue
+		}
+		job.Status = "failed"
+		job.CompletedAt = &now
+		jm.persistExportJob(job)
+		jm.notifyExportFinished(job)
+		recovered++
+	}
+
+	if recovered > 0 {
+		log.Printf("Marked %d interrupted jobs as failed", recovered)
+	}
+}
+
+// persistImportJob writes an import job to the store; callers must hold the mutex
+func (jm *JobManager) persistImportJob(job *models.ImportJob) {
+	if jm.store == nil {
+		return
+	}
+	if err := jm.store.SaveImportJob(job); err != nil {
+		log.Printf("Failed to persist import job %s: %v", job.ID, err)
+	}
+}
+
+// persistExportJob writes an export job to the store; callers must hold the mutex
+func (jm *JobManager) persistExportJob(job *models.ExportJob) {
+	if jm.store == nil {
+		return
+	}
+	if err := jm.store.SaveExportJob(job); err != nil {
+		log.Printf("Failed to persist export job %s: %v", job.ID, err)
+	}
+}
+
+// CreateImportJob creates a new import job for a file on local disk, or an
+// s3:// object the job reads in place. A streamed import has no file path.
+func (jm *JobManager) CreateImportJob(resourceType, format, filePath string) *models.ImportJob {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	var fileName string
+	if filePath != "" {
+		fileName = filepath.Base(filePath)
+	}
+
+	job := &models.ImportJob{
+		ID:           uuid.New().String(),
+		Status:       "pending",
+		ResourceType: resourceType,
+		Format:       format,
+		FileName:     fileName,
+		FilePath:     filePath,
+		TotalRecords: 0,
+		ValidRecords: 0,
+		ErrorRecords: 0,
+		Errors:       make([]models.ValidationError, 0),
+		CreatedAt:    time.Now(),
+		Progress:     0,
+	}
+
+	jm.importJobs[job.ID] = job
+	jm.persistImportJob(job)
+	return job
+}
+
+// CreateExportJob creates a new export job
+func (jm *JobManager) CreateExportJob(resourceType, format string, filters map[string]string) *models.ExportJob {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	job := &models.ExportJob{
+		ID:           uuid.New().String(),
+		Status:       "pending",
+		ResourceType: resourceType,
+		Format:       format,
+		Filters:      filters,
+		TotalRecords: 0,
+		CreatedAt:    time.Now(),
+		Progress:     0,
+	}
+
+	jm.exportJobs[job.ID] = job
+	jm.persistExportJob(job)
+	return job
+}
+
+// GetImportJob retrieves an import job by ID
+func (jm *JobManager) GetImportJob(id string) (*models.ImportJob, bool) {
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	job, exists := jm.importJobs[id]
+	if !exists {
+		return nil, false
+	}
+
+	// Return a copy to avoid concurrent modification
+	jobCopy := *job
+	jobCopy.Errors = make([]models.ValidationError, len(job.Errors))
+	copy(jobCopy.Errors, job.Errors)
+	jobCopy.Warnings = slices.Clone(job.Warnings)
+	jobCopy.TransformCounts = slices.Clone(job.TransformCounts)
+	if job.Checkpoint != nil {
+		checkpoint := *job.Checkpoint
+		jobCopy.Checkpoint = &checkpoint
+	}
+	if job.DryRunResult != nil {
+		result := *job.DryRunResult
+		jobCopy.DryRunResult = &result
+	}
+	if job.Source != nil {
+		source := *job.Source
+		jobCopy.Source = &source
+	}
+
+	return &jobCopy, true
+}
+
+// GetExportJob retrieves an export job by ID
+func (jm *JobManager) GetExportJob(id string) (*models.ExportJob, bool) {
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	job, exists := jm.exportJobs[id]
+	if !exists {
+		return nil, false
+	}
+
+	// Return a copy to avoid concurrent modification
+	jobCopy := *job
+	return &jobCopy, true
+}
+
+// UpdateImportJob updates the status and progress of an import job
+func (jm *JobManager) UpdateImportJob(id string, status string, progress int, totalRecords, validRecords, errorRecords int, errors []models.ValidationError) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists {
+		previousStatus := job.Status
+		wasTerminal := isTerminalStatus(job.Status)
+
+		// A cancelled job keeps its status; late updates only refresh counters
+		if job.Status != "cancelled" {
+			job.Status = status
+		}
+		job.Progress = progress
+		job.TotalRecords = totalRecords
+		job.ValidRecords = validRecords
+
+		// Count every error and spill it to the error report; only a sample stays in memory
+		jm.recordImportErrors(job, errors)
+
+		if job.DryRunResult != nil {
+			job.DryRunResult.ValidRecords = job.ValidRecords
+			job.DryRunResult.InvalidRecords = job.TotalRecords - job.ValidRecords
+		}
+
+		if (status == "completed" || status == "failed") && job.Status == status {
+			now := time.Now()
+			job.CompletedAt = &now
+		}
+		if isTerminalStatus(job.Status) {
+			job.ETASeconds = 0
+		}
+
+		jm.persistImportJob(job)
+		jm.publishImportUpdate(job, previousStatus, errors)
+
+		if !wasTerminal && isTerminalStatus(job.Status) {
+			jm.notifyImportFinished(job)
+		}
+	}
+}
+
+// UpdateExportJob updates the status and progress of an export job
+func (jm *JobManager) UpdateExportJob(id string, status string, progress int, totalRecords int, downloadURL string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.exportJobs[id]; exists {
+		// A cancelled job keeps its status; late updates only refresh counters
+		if job.Status == "cancelled" {
+			job.Progress = progress
+			job.TotalRecords = totalRecords
+			jm.persistExportJob(job)
+			return
+		}
+
+		previousStatus := job.Status
+		wasTerminal := isTerminalStatus(job.Status)
+
+		job.Status = status
+		job.Progress = progress
+		job.TotalRecords = totalRecords
+		job.DownloadURL = downloadURL
+
+		if status == "completed" || status == "failed" {
+			now := time.Now()
+			job.CompletedAt = &now
+		}
+
+		jm.persistExportJob(job)
+		jm.publishExportUpdate(job, previousStatus)
+
+		if !wasTerminal && isTerminalStatus(job.Status) {
+			jm.notifyExportFinished(job)
+		}
+	}
+}
+
+// UpdateImportThroughput records how much of its source file an import has
+// consumed, its row rate and the estimated time remaining. These live figures
+// are not persisted; they are published with the next progress event.
+func (jm *JobManager) UpdateImportThroughput(id string, bytesProcessed, fileSize int64, rowsPerSecond float64, remaining time.Duration) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists {
+		job.BytesProcessed = bytesProcessed
+		job.FileSize = fileSize
+		job.RowsPerSecond = math.Round(rowsPerSecond*10) / 10
+		job.ETASeconds = int(math.Ceil(remaining.Seconds()))
+	}
+}
+
+// AddImportWarnings records warnings about an import job, ignoring ones it
+// already has. Only the first maxImportWarnings are kept.
+func (jm *JobManager) AddImportWarnings(id string, warnings ...string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	job, exists := jm.importJobs[id]
+	if !exists {
+		return
+	}
+	added := false
+	for _, warning := range warnings {
+		if len(job.Warnings) < maxImportWarnings && !slices.Contains(job.Warnings, warning) {
+			job.Warnings = append(job.Warnings, warning)
+			added = true
+		}
+	}
+	if added {
+		jm.persistImportJob(job)
+	}
+}
+
+// RecordTransformCounts adds the values the transform steps of an import job
+// changed since they were last recorded
+func (jm *JobManager) RecordTransformCounts(id string, counts []models.TransformCount) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	job, exists := jm.importJobs[id]
+	if !exists || len(counts) == 0 {
+		return
+	}
+	for _, count := range counts {
+		i := slices.IndexFunc(job.TransformCounts, func(existing models.TransformCount) bool {
+			return existing.Field == count.Field && existing.Step == count.Step
+		})
+		if i < 0 {
+			job.TransformCounts = append(job.TransformCounts, count)
+		} else {
+			job.TransformCounts[i].Changed += count.Changed
+		}
+	}
+	jm.persistImportJob(job)
+}
+
+// RecordDryRunBatch counts the records a batch of a dry-run import would have
+// created and updated
+func (jm *JobManager) RecordDryRunBatch(id string, wouldCreate, wouldUpdate int) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists && job.DryRunResult != nil {
+		job.DryRunResult.WouldCreate += wouldCreate
+		job.DryRunResult.WouldUpdate += wouldUpdate
+		jm.persistImportJob(job)
+	}
+}
+
+// RecordCommittedBatch counts a batch of an import job that was written to the database
+func (jm *JobManager) RecordCommittedBatch(id string) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists && !job.Options.DryRun {
+		job.CommittedBatches++
+		jm.persistImportJob(job)
+		jm.publishImportUpdate(job, job.Status, nil)
+	}
+}
+
+// SaveImportCheckpoint records the position reached after a flushed batch so
+// the job can later resume from there. Dry runs write nothing, so they keep
+// no checkpoint and start over when resumed.
+func (jm *JobManager) SaveImportCheckpoint(id string, checkpoint models.ImportCheckpoint) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if job, exists := jm.importJobs[id]; exists && !job.Options.DryRun {
+		checkpoint.ErrorCount = job.ErrorRecords
+		checkpoint.ErrorReportOffset = jm.errorReportSize(id)
+		job.Checkpoint = &checkpoint
+		jm.persistImportJob(job)
+	}
+}
+
+// ResumeImportJob moves a failed or cancelled import job back to pending.
+// Counters and errors are rolled back to the last checkpoint, since every
+// record after it will be read again.
+func (jm *JobManager) ResumeImportJob(id string) (*models.ImportJob, error) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	job, exists := jm.importJobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != "failed" && job.Status != "cancelled" {
+		return nil, ErrJobNotResumable
+	}
+
+	checkpoint := models.ImportCheckpoint{}
+	if job.Checkpoint != nil {
+		checkpoint = *job.Checkpoint
+	}
+	jm.rollbackImportErrors(job, checkpoint)
+	if job.DryRunResult != nil {
+		// A dry run keeps no checkpoint, so it starts over
+		job.DryRunResult = &models.DryRunResult{}
+		job.TransformCounts = nil
+	}
+
+	previousStatus := job.Status
+	job.Status = "pending"
+	job.CompletedAt = nil
+	job.TotalRecords = checkpoint.RowNumber
+	job.ValidRecords = checkpoint.ValidRecords
+	jm.persistImportJob(job)
+	jm.publishImportUpdate(job, previousStatus, nil)
+
+	jobCopy := *job
+	jobCopy.Errors = nil
+	return &jobCopy, nil
+}
+
+// CancelImportJob marks a pending or processing import job as cancelled
+func (jm *JobManager) CancelImportJob(id string) (*models.ImportJob, error) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	job, exists := jm.importJobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if isTerminalStatus(job.Status) {
+		return nil, ErrJobFinished
+	}
+
+	previousStatus := job.Status
+	now := time.Now()
+	job.Status = "cancelled"
+	job.CompletedAt = &now
+	jm.persistImportJob(job)
+	jm.publishImportUpdate(job, previousStatus, nil)
+	jm.notifyImportFinished(job)
+
+	jobCopy := *job
+	jobCopy.Errors = nil
+	return &jobCopy, nil
+}
+
+// CancelExportJob marks a pending or processing export job as cancelled
+func (jm *JobManager) CancelExportJob(id string) (*models.ExportJob, error) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	job, exists := jm.exportJobs[id]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if isTerminalStatus(job.Status) {
+		return nil, ErrJobFinished
+	}
+
+	previousStatus := job.Status
+	now := time.Now()
+	job.Status = "cancelled"
+	job.CompletedAt = &now
+	jm.persistExportJob(job)
+	jm.publishExportUpdate(job, previousStatus)
+	jm.notifyExportFinished(job)
+
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
+// JobProcessor handles the actual processing of jobs
+type JobProcessor struct {
+	jobManager  *JobManager
+	storage     Storage
+	processor   DataProcessor
+	config      QueueConfig
+	importQueue *jobQueue
+	exportQueue *jobQueue
+	streamSlots chan struct{}                 // held by streamed imports, which don't wait in the import queue
+	running     map[string]context.CancelFunc // job ID -> cancel for jobs held by a worker
+	runningMu   sync.Mutex
+	fetcher     *fetch.Fetcher // optional; downloads the remote sources of import jobs
+}
+
+// Storage interface for job processing
+type Storage interface {
+	BatchInsertUsers(users []models.User) error
+	BatchInsertArticles(articles []models.Article) error
+	BatchInsertComments(comments []models.Comment) error
+	CountUsers(filters map[string]string) (int, error)
+	CountArticles(filters map[string]string) (int, error)
+	CountComments(filters map[string]string) (int, error)
+}
+
+// DataProcessor interface for processing import/export data
+type DataProcessor interface {
+	ProcessImport(ctx context.Context, job *models.ImportJob) error
+	ProcessImportStream(ctx context.Context, job *models.ImportJob, body io.Reader, size int64) error
+	ProcessExport(ctx context.Context, jobID string, resourceType string, format string, filters map[string]string, totalRecords int, destination string) (string, error)
+	ExtractBundle(archivePath, format, dir string) ([]models.BundleFile, error)
+	CheckMapping(ctx context.Context, filePath, resourceType, format string, options models.ImportOptions) ([]string, error)
+}
+
+// NewJobProcessor creates a new job processor with bounded import and export queues
+func NewJobProcessor(jobManager *JobManager, storage Storage, processor DataProcessor, config QueueConfig) *JobProcessor {
+	return &JobProcessor{
+		jobManager:  jobManager,
+		storage:     storage,
+		processor:   processor,
+		config:      config,
+		importQueue: newJobQueue(config.ImportQueueSize),
+		exportQueue: newJobQueue(config.ExportQueueSize),
+		streamSlots: make(chan struct{}, max(config.ImportWorkers, 1)),
+		running:     make(map[string]context.CancelFunc),
+	}
+}
+
+// Start launches the import and export workers
+func (jp *JobProcessor) Start() {
+	jp.importQueue.start(jp.config.ImportWorkers)
+	jp.exportQueue.start(jp.config.ExportWorkers)
+}
+
+// EnqueueImportJob queues an import job for the next free import worker
+func (jp *JobProcessor) EnqueueImportJob(jobID string) error {
+	return jp.importQueue.push(queuedJob{
+		id: jobID,
+		run: func(ctx context.Context) {
+			jp.ProcessImportJob(ctx, jobID)
+		},
+	})
+}
+
+// ResumeImportJob re-queues a failed or cancelled import job so it continues
+// from its last checkpoint
+func (jp *JobProcessor) ResumeImportJob(jobID string) (*models.ImportJob, error) {
+	job, exists := jp.jobManager.GetImportJob(jobID)
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	// An S3 object is checked when the job reads it again; a streamed import
+	// whose body never reached a spool file has no file at all
+	if !s3.IsURL(job.FilePath) {
+		if _, err := os.Stat(job.FilePath); job.FilePath == "" || err != nil {
+			return nil, ErrSourceFileMissing
+		}
+	}
+	if jp.importQueue.full() {
+		return nil, ErrQueueFull
+	}
+
+	resumed, err := jp.jobManager.ResumeImportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := jp.EnqueueImportJob(jobID); err != nil {
+		jp.jobManager.UpdateImportJob(jobID, "failed", resumed.Progress, resumed.TotalRecords, resumed.ValidRecords, 0,
+			[]models.ValidationError{{
+				Row:     0,
+				Field:   "general",
+				Message: fmt.Sprintf("Import not resumed: %v", err),
+			}})
+		return nil, err
+	}
+
+	return resumed, nil
+}
+
+// EnqueueExportJob queues an export job for the next free export worker
+func (jp *JobProcessor) EnqueueExportJob(jobID string) error {
+	return jp.exportQueue.push(queuedJob{
+		id: jobID,
+		run: func(ctx context.Context) {
+			jp.ProcessExportJob(ctx, jobID)
+		},
+	})
+}
+
+// ImportQueueFull reports whether the import queue can accept another job
+func (jp *JobProcessor) ImportQueueFull() bool {
+	return jp.importQueue.full()
+}
+
+// AcquireImportStreamSlot takes one of the slots streamed imports run in,
+// which are as many as the import workers, so that streams can't hold more
+// database connections than queued imports do. It reports false when every
+// slot is taken; otherwise release must be called once the stream has run.
+func (jp *JobProcessor) AcquireImportStreamSlot() (release func(), ok bool) {
+	select {
+	case jp.streamSlots <- struct{}{}:
+		return func() { <-jp.streamSlots }, true
+	default:
+		return nil, false
+	}
+}
+
+// ExportQueueFull reports whether the export queue can accept another job
+func (jp *JobProcessor) ExportQueueFull() bool {
+	return jp.exportQueue.full()
+}
+
+// ImportQueuePosition returns the 1-based queue position of a pending import job, or 0
+func (jp *JobProcessor) ImportQueuePosition(jobID string) int {
+	return jp.importQueue.position(jobID)
+}
+
+// ExportQueuePosition returns the 1-based queue position of a pending export job, or 0
+func (jp *JobProcessor) ExportQueuePosition(jobID string) int {
+	return jp.exportQueue.position(jobID)
+}
+
+// CancelImportJob cancels a queued or running import job. Batches already
+// committed stay in the database and are reported on the returned job.
+func (jp *JobProcessor) CancelImportJob(jobID string) (*models.ImportJob, error) {
+	job, err := jp.jobManager.CancelImportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	jp.importQueue.remove(jobID)
+	jp.cancelRunning(jobID)
+	return job, nil
+}
+
+// CancelExportJob cancels a queued or running export job; its partial file is removed
+func (jp *JobProcessor) CancelExportJob(jobID string) (*models.ExportJob, error) {
+	job, err := jp.jobManager.CancelExportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	jp.exportQueue.remove(jobID)
+	jp.cancelRunning(jobID)
+	return job, nil
+}
+
+// startRunning creates the context a worker runs a job under and registers it for cancellation
+func (jp *JobProcessor) startRunning(ctx context.Context, jobID string) (context.Context, func()) {
+	// Create a timeout context for this specific job
+	jobCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+
+	jp.runningMu.Lock()
+	jp.running[jobID] = cancel
+	jp.runningMu.Unlock()
+
+	return jobCtx, func() {
+		jp.runningMu.Lock()
+		delete(jp.running, jobID)
+		jp.runningMu.Unlock()
+		cancel()
+	}
+}
+
+// cancelRunning cancels the context of a job currently held by a worker
+func (jp *JobProcessor) cancelRunning(jobID string) {
+	jp.runningMu.Lock()
+	defer jp.runningMu.Unlock()
+
+	if cancel, exists := jp.running[jobID]; exists {
+		cancel()
+	}
+}
+
+// ProcessImportJob runs an import job to completion on the calling goroutine,
+// downloading its remote source first if it has one. The source file is
+// removed once the job completes; failed and cancelled jobs keep it so they
+// can be resumed.
+func (jp *JobProcessor) ProcessImportJob(ctx context.Context, jobID string) {
+	jobCtx, done := jp.startRunning(ctx, jobID)
+	defer done()
+
+	job, exists := jp.jobManager.GetImportJob(jobID)
+	if !exists || job.Status != "pending" {
+		return
+	}
+
+	// A job importing a file_url downloads it first, resuming where an earlier run stopped
+	if job.Source != nil && !job.Source.Downloaded {
+		if !jp.downloadSource(jobCtx, job) {
+			return
+		}
+	}
+
+	if job.ResourceType == "bundle" {
+		jp.processBundle(jobCtx, job)
+		return
+	}
+	jp.runImport(jobCtx, job)
+}
+
+// runImport processes a pending import job and reports whether it completed
+func (jp *JobProcessor) runImport(ctx context.Context, job *models.ImportJob) bool {
+	// Mark job as processing, keeping counters restored from a checkpoint
+	jp.jobManager.UpdateImportJob(job.ID, "processing", job.Progress, job.TotalRecords, job.ValidRecords, 0, nil)
+
+	// Process the import
+	return jp.finishImport(ctx, job.ID, jp.processor.ProcessImport(ctx, job))
+}
+
+// ProcessImportStream runs a pending import job on the calling goroutine,
+// reading its records from body as it arrives instead of from a file. It
+// doesn't wait for a worker, since the body is already on its way.
+func (jp *JobProcessor) ProcessImportStream(ctx context.Context, jobID string, body io.Reader, size int64) bool {
+	jobCtx, done := jp.startRunning(ctx, jobID)
+	defer done()
+
+	job, exists := jp.jobManager.GetImportJob(jobID)
+	if !exists || job.Status != "pending" {
+		return false
+	}
+	jp.jobManager.UpdateImportJob(job.ID, "processing", 0, 0, 0, 0, nil)
+	return jp.finishImport(jobCtx, job.ID, jp.processor.ProcessImportStream(jobCtx, job, body, size))
+}
+
+// finishImport fails an import job whose processing returned an error, and
+// removes the source file of one that completed. It reports whether the job
+// completed.
+func (jp *JobProcessor) finishImport(ctx context.Context, jobID string, err error) bool {
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return false
+		}
+		jp.failImportJob(jobID, fmt.Sprintf("Import failed: %v", err))
+		return false
+	}
+
+	if current, exists := jp.jobManager.GetImportJob(jobID); exists && current.Status == "completed" {
+		if ownsFile(current.FilePath) {
+			os.Remove(current.FilePath)
+		}
+		return true
+	}
+	return false
+}
+
+// failImportJob marks an import job as failed with a general error, keeping its counters
+func (jp *JobProcessor) failImportJob(jobID, message string) {
+	current, exists := jp.jobManager.GetImportJob(jobID)
+	if !exists {
+		return
+	}
+	jp.jobManager.UpdateImportJob(jobID, "failed", current.Progress, current.TotalRecords, current.ValidRecords, 0,
+		[]models.ValidationError{{
+			Row:     0,
+			Field:   "general",
+			Message: message,
+		}})
+}
+
+// ProcessExportJob runs an export job to completion on the calling goroutine
+func (jp *JobProcessor) ProcessExportJob(ctx context.Context, jobID string) {
+	jobCtx, done := jp.startRunning(ctx, jobID)
+	defer done()
+
+	job, exists := jp.jobManager.GetExportJob(jobID)
+	if !exists || job.Status != "pending" {
+		return
+	}
+
+	// Mark job as processing
+	jp.jobManager.UpdateExportJob(jobID, "processing", 0, 0, "")
+
+	// Get total count
+	var totalRecords int
+	var err error
+
+	switch job.ResourceType {
+	case "users":
+		totalRecords, err = jp.storage.CountUsers(job.Filters)
+	case "articles":
+		totalRecords, err = jp.storage.CountArticles(job.Filters)
+	case "comments":
+		totalRecords, err = jp.storage.CountComments(job.Filters)
+	default:
+		err = fmt.Errorf("unknown resource type: %s", job.ResourceType)
+	}
+
+	if err != nil {
+		jp.jobManager.UpdateExportJob(jobID, "failed", 100, 0, "")
+		return
+	}
+
+	// Process the export
+	downloadURL, err := jp.processor.ProcessExport(jobCtx, jobID, job.ResourceType, job.Format, job.Filters, totalRecords, job.Destination)
+
+	if err != nil {
+		jp.jobManager.UpdateExportJob(jobID, "failed", 100, totalRecords, "")
+	} else {
+		jp.jobManager.UpdateExportJob(jobID, "completed", 100, totalRecords, downloadURL)
+	}
+}
+
+// CleanupOldJobs removes jobs older than the specified duration
+func (jm *JobManager) CleanupOldJobs(maxAge time.Duration) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+
+	// Clean up import jobs along with any source file kept for resuming
+	for id, job := range jm.importJobs {
+		if job.CreatedAt.Before(cutoff) {
+			if ownsFile(job.FilePath) {
+				os.Remove(job.FilePath)
+			}
+			if job.ResourceType == "bundle" {
+				os.RemoveAll(BundleDir(job.FilePath))
+			}
+			jm.removeErrorReport(id)
+			delete(jm.importJobs, id)
+			jm.events.remove(id)
+		}
+	}
+
+	// Clean up export jobs
+	for id, job := range jm.exportJobs {
+		if job.CreatedAt.Before(cutoff) {
+			delete(jm.exportJobs, id)
+			jm.events.remove(id)
+		}
+	}
+
+	if jm.store != nil {
+		if err := jm.store.DeleteJobsBefore(cutoff); err != nil {
+			log.Printf("Failed to delete old jobs from store: %v", err)
+		}
+	}
+}
+
+// ImportSourceFiles returns the source files still referenced by import jobs
+func (jm *JobManager) ImportSourceFiles() map[string]bool {
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	files := make(map[string]bool)
+	for _, job := range jm.importJobs {
+		if ownsFile(job.FilePath) && job.Status != "completed" {
+			files[filepath.Clean(job.FilePath)] = true
+		}
+	}
+	return files
+}
+
+// ownsFile reports whether an import reads a local file the job owns, rather
+// than an S3 object it reads in place and leaves alone
+func ownsFile(path string) bool {
+	return path != "" && !s3.IsURL(path)
+}
+
+// GetJobStats returns statistics about running jobs
+func (jm *JobManager) GetJobStats() map[string]interface{} {
+	jm.mutex.RLock()
+	defer jm.mutex.RUnlock()
+
+	importStats := make(map[string]int)
+	exportStats := make(map[string]int)
+
+	for _, job := range jm.importJobs {
+		importStats[job.Status]++
+	}
+
+	for _, job := range jm.exportJobs {
+		exportStats[job.Status]++
+	}
+
+	return map[string]interface{}{
+		"import_jobs":       importStats,
+		"export_jobs":       exportStats,
+		"total_import_jobs": len(jm.importJobs),
+		"total_export_jobs": len(jm.exportJobs),
+	}
+}
+
+// Helper function for min
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,1000 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/fetch"
+)
+
+// memoryStore is a JobStore, IdempotencyStore, ProfileStore and UploadStore used to exercise persistence in tests
+type memoryStore struct {
+	importJobs      map[string]models.ImportJob
+	exportJobs      map[string]models.ExportJob
+	idempotencyKeys map[string]models.IdempotencyKey
+	profiles        map[string]models.MappingProfile
+	uploads         map[string]models.UploadSession
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		importJobs:      make(map[string]models.ImportJob),
+		exportJobs:      make(map[string]models.ExportJob),
+		idempotencyKeys: make(map[string]models.IdempotencyKey),
+		profiles:        make(map[string]models.MappingProfile),
+		uploads:         make(map[string]models.UploadSession),
+	}
+}
+
+func (s *memoryStore) SaveImportJob(job *models.ImportJob) error {
+	saved := *job
+	if existing, exists := s.importJobs[job.ID]; exists {
+		// Like the Postgres upsert, columns that never change keep their first value
+		saved.ResourceType, saved.Format, saved.CreatedAt = existing.ResourceType, existing.Format, existing.CreatedAt
+	}
+	s.importJobs[job.ID] = saved
+	return nil
+}
+
+func (s *memoryStore) SaveExportJob(job *models.ExportJob) error {
+	s.exportJobs[job.ID] = *job
+	return nil
+}
+
+func (s *memoryStore) LoadImportJobs() ([]*models.ImportJob, error) {
+	var jobs []*models.ImportJob
+	for _, job := range s.importJobs {
+		jobCopy := job
+		jobs = append(jobs, &jobCopy)
+	}
+	return jobs, nil
+}
+
+func (s *memoryStore) LoadExportJobs() ([]*models.ExportJob, error) {
+	var jobs []*models.ExportJob
+	for _, job := range s.exportJobs {
+		jobCopy := job
+		jobs = append(jobs, &jobCopy)
+	}
+	return jobs, nil
+}
+
+func (s *memoryStore) DeleteJobsBefore(cutoff time.Time) error {
+	for id, job := range s.importJobs {
+		if job.CreatedAt.Before(cutoff) {
+			delete(s.importJobs, id)
+		}
+	}
+	for id, job := range s.exportJobs {
+		if job.CreatedAt.Before(cutoff) {
+			delete(s.exportJobs, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) SaveIdempotencyKey(key *models.IdempotencyKey) error {
+	s.idempotencyKeys[key.Scope+"/"+key.Key] = *key
+	return nil
+}
+
+func (s *memoryStore) LoadIdempotencyKeys() ([]*models.IdempotencyKey, error) {
+	var keys []*models.IdempotencyKey
+	for _, key := range s.idempotencyKeys {
+		keyCopy := key
+		keys = append(keys, &keyCopy)
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) DeleteIdempotencyKeysBefore(cutoff time.Time) error {
+	for id, key := range s.idempotencyKeys {
+		if key.CreatedAt.Before(cutoff) {
+			delete(s.idempotencyKeys, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) SaveMappingProfile(profile *models.MappingProfile) error {
+	s.profiles[profile.Name] = *profile
+	return nil
+}
+
+func (s *memoryStore) LoadMappingProfiles() ([]*models.MappingProfile, error) {
+	var profiles []*models.MappingProfile
+	for _, profile := range s.profiles {
+		profileCopy := profile
+		profiles = append(profiles, &profileCopy)
+	}
+	return profiles, nil
+}
+
+func (s *memoryStore) DeleteMappingProfile(name string) error {
+	delete(s.profiles, name)
+	return nil
+}
+
+func (s *memoryStore) SaveUploadSession(session *models.UploadSession) error {
+	s.uploads[session.ID] = *session
+	return nil
+}
+
+func (s *memoryStore) LoadUploadSessions() ([]*models.UploadSession, error) {
+	var sessions []*models.UploadSession
+	for _, session := range s.uploads {
+		sessionCopy := session
+		sessions = append(sessions, &sessionCopy)
+	}
+	return sessions, nil
+}
+
+func (s *memoryStore) DeleteUploadSession(id string) error {
+	delete(s.uploads, id)
+	return nil
+}
+
+// recordingNotifier records the statuses of the finished jobs it is told about
+type recordingNotifier struct {
+	finished map[string]string
+}
+
+func (n *recordingNotifier) ImportJobFinished(job models.ImportJob) {
+	n.finished[job.ID] = job.Status
+}
+
+func (n *recordingNotifier) ExportJobFinished(job models.ExportJob) {
+	n.finished[job.ID] = job.Status
+}
+
+func TestJobsSurviveRestart(t *testing.T) {
+	store := newMemoryStore()
+
+	jm, err := NewJobManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	done := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+	jm.UpdateImportJob(done.ID, "completed", 100, 10, 9, 0, []models.ValidationError{{Row: 3, Field: "email"}})
+	running := jm.CreateImportJob("articles", "ndjson", "uploads/articles.ndjson")
+	jm.UpdateImportJob(running.ID, "processing", 20, 100, 100, 0, nil)
+	export := jm.CreateExportJob("users", "csv", nil)
+
+	// Simulate a restart with a fresh manager on the same store
+	restarted, err := NewJobManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	restarted.SetErrorReportDir(t.TempDir())
+	notifier := &recordingNotifier{finished: make(map[string]string)}
+	restarted.SetNotifier(notifier)
+	restarted.RecoverInterruptedJobs()
+
+	job, exists := restarted.GetImportJob(done.ID)
+	if !exists {
+		t.Fatal("Expected completed job to survive restart")
+	}
+	if job.Status != "completed" || job.ValidRecords != 9 || len(job.Errors) != 1 {
+		t.Errorf("Expected completed job with 9 valid records and 1 error, got %+v", job)
+	}
+
+	job, _ = restarted.GetImportJob(running.ID)
+	if job.Status != "failed" {
+		t.Errorf("Expected interrupted import to be failed, got %s", job.Status)
+	}
+	if job.CompletedAt == nil {
+		t.Error("Expected interrupted import to have CompletedAt set")
+	}
+	var report bytes.Buffer
+	restarted.WriteImportErrorReport(running.ID, "ndjson", &report)
+	if job.ErrorRecords != 1 || !strings.Contains(report.String(), "interrupted by server restart") {
+		t.Errorf("Expected the restart error in the job's error report, got %d errors and %q", job.ErrorRecords, report.String())
+	}
+
+	exportJob, _ := restarted.GetExportJob(export.ID)
+	if exportJob.Status != "failed" {
+		t.Errorf("Expected pending export to be failed, got %s", exportJob.Status)
+	}
+	if len(notifier.finished) != 2 || notifier.finished[running.ID] != "failed" || notifier.finished[export.ID] != "failed" {
+		t.Errorf("Expected the notifier to be told about both interrupted jobs, got %v", notifier.finished)
+	}
+}
+
+func TestCleanupOldJobsRemovesFromStore(t *testing.T) {
+	store := newMemoryStore()
+	jm, _ := NewJobManagerWithStore(store)
+
+	job := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+	jm.CleanupOldJobs(-time.Minute)
+
+	if _, exists := jm.GetImportJob(job.ID); exists {
+		t.Error("Expected job to be removed from manager")
+	}
+	if _, exists := store.importJobs[job.ID]; exists {
+		t.Error("Expected job to be removed from store")
+	}
+}
+
+func TestJobQueueCapacityAndPosition(t *testing.T) {
+	q := newJobQueue(2)
+	noop := func(ctx context.Context) {}
+
+	if err := q.push(queuedJob{id: "a", run: noop}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := q.push(queuedJob{id: "b", run: noop}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := q.push(queuedJob{id: "c", run: noop}); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got: %v", err)
+	}
+	if !q.full() {
+		t.Error("Expected queue to be full")
+	}
+
+	if pos := q.position("b"); pos != 2 {
+		t.Errorf("Expected position 2, got %d", pos)
+	}
+
+	if job := q.pop(); job.id != "a" {
+		t.Errorf("Expected FIFO order, got %s", job.id)
+	}
+	if pos := q.position("b"); pos != 1 {
+		t.Errorf("Expected position 1 after pop, got %d", pos)
+	}
+	if pos := q.position("a"); pos != 0 {
+		t.Errorf("Expected popped job to have no position, got %d", pos)
+	}
+}
+
+// stubProcessor is a DataProcessor that does nothing. Fakes embed it and
+// override only the methods their tests use.
+type stubProcessor struct{}
+
+func (stubProcessor) ProcessImport(ctx context.Context, job *models.ImportJob) error {
+	return nil
+}
+
+func (stubProcessor) ProcessImportStream(ctx context.Context, job *models.ImportJob, body io.Reader, size int64) error {
+	return nil
+}
+
+func (stubProcessor) ProcessExport(ctx context.Context, jobID string, resourceType string, format string, filters map[string]string, totalRecords int, destination string) (string, error) {
+	return "", nil
+}
+
+func (stubProcessor) ExtractBundle(archivePath, format, dir string) ([]models.BundleFile, error) {
+	return nil, errors.New("bundles are not supported")
+}
+
+func (stubProcessor) CheckMapping(ctx context.Context, filePath, resourceType, format string, options models.ImportOptions) ([]string, error) {
+	return nil, nil
+}
+
+// blockingProcessor is a DataProcessor that runs until its context is cancelled
+type blockingProcessor struct {
+	stubProcessor
+	started chan struct{}
+}
+
+func (bp *blockingProcessor) ProcessImport(ctx context.Context, job *models.ImportJob) error {
+	close(bp.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCancelRunningImportJob(t *testing.T) {
+	jm := NewJobManager()
+	processor := &blockingProcessor{started: make(chan struct{})}
+	jp := NewJobProcessor(jm, nil, processor, DefaultQueueConfig())
+
+	job := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+	finished := make(chan struct{})
+	go func() {
+		jp.ProcessImportJob(context.Background(), job.ID)
+		close(finished)
+	}()
+	<-processor.started
+
+	jm.RecordCommittedBatch(job.ID)
+	cancelled, err := jp.CancelImportJob(job.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cancelled.CommittedBatches != 1 {
+		t.Errorf("Expected 1 committed batch, got %d", cancelled.CommittedBatches)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Expected running import to stop after cancellation")
+	}
+
+	final, _ := jm.GetImportJob(job.ID)
+	if final.Status != "cancelled" {
+		t.Errorf("Expected status 'cancelled', got %s", final.Status)
+	}
+
+	if _, err := jp.CancelImportJob(job.ID); err != ErrJobFinished {
+		t.Errorf("Expected ErrJobFinished, got: %v", err)
+	}
+}
+
+func TestCancelQueuedExportJob(t *testing.T) {
+	jm := NewJobManager()
+	jp := NewJobProcessor(jm, nil, &blockingProcessor{}, DefaultQueueConfig())
+
+	job := jm.CreateExportJob("users", "csv", nil)
+	if err := jp.EnqueueExportJob(job.ID); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if _, err := jp.CancelExportJob(job.ID); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if pos := jp.ExportQueuePosition(job.ID); pos != 0 {
+		t.Errorf("Expected cancelled job to leave the queue, got position %d", pos)
+	}
+}
+
+func TestResumeImportJobRollsBackToCheckpoint(t *testing.T) {
+	jm := NewJobManager()
+	job := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+
+	jm.UpdateImportJob(job.ID, "processing", 10, 1000, 990, 0, []models.ValidationError{{Row: 5, Field: "email"}})
+	jm.SaveImportCheckpoint(job.ID, models.ImportCheckpoint{ByteOffset: 4096, RowNumber: 1000, ValidRecords: 990})
+
+	// Rows read after the checkpoint, then a failure
+	jm.UpdateImportJob(job.ID, "processing", 15, 1200, 990, 0, []models.ValidationError{{Row: 1100, Field: "role"}})
+	jm.UpdateImportJob(job.ID, "failed", 15, 1200, 990, 0, []models.ValidationError{{Field: "general"}})
+
+	resumed, err := jm.ResumeImportJob(job.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if resumed.Status != "pending" || resumed.CompletedAt != nil {
+		t.Errorf("Expected pending job without CompletedAt, got %s", resumed.Status)
+	}
+	if resumed.TotalRecords != 1000 || resumed.ValidRecords != 990 {
+		t.Errorf("Expected counters from checkpoint, got total=%d valid=%d", resumed.TotalRecords, resumed.ValidRecords)
+	}
+
+	current, _ := jm.GetImportJob(job.ID)
+	if len(current.Errors) != 1 || current.Errors[0].Row != 5 {
+		t.Errorf("Expected only errors before the checkpoint, got %+v", current.Errors)
+	}
+	if current.Checkpoint == nil || current.Checkpoint.ByteOffset != 4096 {
+		t.Errorf("Expected checkpoint to be kept, got %+v", current.Checkpoint)
+	}
+
+	if _, err := jm.ResumeImportJob(job.ID); err != ErrJobNotResumable {
+		t.Errorf("Expected ErrJobNotResumable for a pending job, got: %v", err)
+	}
+}
+
+func TestListImportJobsFiltersAndPaginates(t *testing.T) {
+	jm := NewJobManager()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		job := jm.CreateImportJob("users", "csv", fmt.Sprintf("uploads/users_%d.csv", i))
+		jm.importJobs[job.ID].CreatedAt = base.Add(time.Duration(i) * time.Hour)
+	}
+	other := jm.CreateImportJob("articles", "ndjson", "uploads/articles.ndjson")
+	jm.UpdateImportJob(other.ID, "failed", 100, 0, 0, 0, nil)
+
+	page, cursor, err := jm.ListImportJobs(ListOptions{ResourceType: "users", Limit: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(page) != 2 || page[0].FileName != "users_4.csv" || page[1].FileName != "users_3.csv" {
+		t.Fatalf("Expected newest users jobs first, got %+v", page)
+	}
+	if cursor == "" {
+		t.Fatal("Expected a next cursor")
+	}
+
+	var names []string
+	for cursor != "" {
+		page, cursor, err = jm.ListImportJobs(ListOptions{ResourceType: "users", Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		for _, job := range page {
+			names = append(names, job.FileName)
+		}
+	}
+	if fmt.Sprint(names) != "[users_2.csv users_1.csv users_0.csv]" {
+		t.Errorf("Expected remaining pages in order, got %v", names)
+	}
+
+	after := base.Add(90 * time.Minute)
+	page, _, _ = jm.ListImportJobs(ListOptions{CreatedAfter: &after, Sort: "created_at", FileName: "USERS"})
+	if len(page) != 3 || page[0].FileName != "users_2.csv" {
+		t.Errorf("Expected 3 jobs created after the cutoff in ascending order, got %+v", page)
+	}
+
+	page, _, _ = jm.ListImportJobs(ListOptions{Status: "failed"})
+	if len(page) != 1 || page[0].ID != other.ID {
+		t.Errorf("Expected only the failed job, got %+v", page)
+	}
+
+	if _, _, err := jm.ListImportJobs(ListOptions{Sort: "created_at", Cursor: encodeCursor(listCursor{Sort: "-created_at"})}); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor for a cursor from another sort order, got: %v", err)
+	}
+}
+
+func TestJobEventsReplayAfterLastEventID(t *testing.T) {
+	jm := NewJobManager()
+	job := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+
+	missed, events, unsubscribe, err := jm.SubscribeImportJob(job.ID, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer unsubscribe()
+	if len(missed) != 0 {
+		t.Errorf("Expected no history for a new job, got %d events", len(missed))
+	}
+
+	jm.UpdateImportJob(job.ID, "processing", 0, 0, 0, 0, nil)
+	jm.UpdateImportJob(job.ID, "processing", 40, 1000, 999, 0, []models.ValidationError{{Row: 7, Field: "email"}})
+	jm.UpdateImportJob(job.ID, "completed", 100, 1000, 999, 0, nil)
+
+	var received []JobEvent
+	for len(received) < 4 {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 4 live events, got %d", len(received))
+		}
+	}
+
+	expectedTypes := []string{EventStatus, EventErrors, EventProgress, EventStatus}
+	for i, event := range received {
+		if event.Type != expectedTypes[i] || event.ID != int64(i+1) {
+			t.Errorf("Event %d: expected %s with ID %d, got %s with ID %d", i, expectedTypes[i], i+1, event.Type, event.ID)
+		}
+	}
+	if !received[3].IsFinal() || received[0].IsFinal() {
+		t.Error("Expected only the completed status event to be final")
+	}
+
+	// A client reconnecting after event 2 gets the rest, including the final status
+	replayed, _, unsubscribeReplay, _ := jm.SubscribeImportJob(job.ID, 2)
+	defer unsubscribeReplay()
+	if len(replayed) != 2 || !replayed[1].IsFinal() {
+		t.Errorf("Expected 2 replayed events ending with the final status, got %+v", replayed)
+	}
+
+	if _, _, _, err := jm.SubscribeExportJob("missing", 0); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got: %v", err)
+	}
+}
+
+func TestImportErrorReportKeepsEveryError(t *testing.T) {
+	jm := NewJobManager()
+	jm.SetErrorReportDir(t.TempDir())
+	job := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+
+	// Report 1500 errors, one batch of 100 at a time
+	for batch := 0; batch < 15; batch++ {
+		errs := make([]models.ValidationError, 100)
+		for i := range errs {
+			errs[i] = models.ValidationError{Row: batch*100 + i + 1, Field: "email", Message: "invalid email"}
+		}
+		jm.UpdateImportJob(job.ID, "processing", 0, (batch+1)*100, 0, 0, errs)
+		if batch == 9 {
+			jm.SaveImportCheckpoint(job.ID, models.ImportCheckpoint{RowNumber: 1000})
+		}
+	}
+
+	current, _ := jm.GetImportJob(job.ID)
+	if current.ErrorRecords != 1500 {
+		t.Errorf("Expected 1500 error records, got %d", current.ErrorRecords)
+	}
+	if len(current.Errors) != errorSampleSize {
+		t.Fatalf("Expected a sample of %d errors, got %d", errorSampleSize, len(current.Errors))
+	}
+	if current.Errors[errorSampleHead-1].Row != errorSampleHead || current.Errors[errorSampleHead].Row != 1001 ||
+		current.Errors[errorSampleSize-1].Row != 1500 {
+		t.Errorf("Expected the first and most recent errors in the sample, got rows %d, %d and %d",
+			current.Errors[errorSampleHead-1].Row, current.Errors[errorSampleHead].Row, current.Errors[errorSampleSize-1].Row)
+	}
+
+	var report bytes.Buffer
+	if err := jm.WriteImportErrorReport(job.ID, "csv", &report); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	if len(lines) != 1501 || lines[0] != "row,field,value,message" {
+		t.Errorf("Expected a header and 1500 CSV rows, got %d lines starting with %q", len(lines), lines[0])
+	}
+
+	// Resuming drops the errors reported after the checkpoint from the report too
+	jm.UpdateImportJob(job.ID, "failed", 0, 1500, 0, 0, nil)
+	if _, err := jm.ResumeImportJob(job.ID); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	current, _ = jm.GetImportJob(job.ID)
+	if current.ErrorRecords != 1000 || len(current.Errors) != 1000 || current.Errors[999].Row != 1000 {
+		t.Errorf("Expected 1000 errors after rollback, got count=%d sample=%d", current.ErrorRecords, len(current.Errors))
+	}
+
+	report.Reset()
+	jm.WriteImportErrorReport(job.ID, "ndjson", &report)
+	if count := strings.Count(report.String(), "\n"); count != 1000 {
+		t.Errorf("Expected 1000 NDJSON lines after rollback, got %d", count)
+	}
+
+	// Without a report, the rolled back errors are dropped from the end of a trimmed sample
+	sampled := jm.CreateImportJob("users", "csv", "uploads/users.csv")
+	jm.SetErrorReportDir("")
+	for batch := 0; batch < 15; batch++ {
+		errs := make([]models.ValidationError, 100)
+		for i := range errs {
+			errs[i] = models.ValidationError{Row: batch*100 + i + 1, Field: "email", Message: "invalid email"}
+		}
+		jm.UpdateImportJob(sampled.ID, "processing", 0, (batch+1)*100, 0, 0, errs)
+		if batch == 11 {
+			jm.SaveImportCheckpoint(sampled.ID, models.ImportCheckpoint{RowNumber: 1200})
+		}
+	}
+	jm.UpdateImportJob(sampled.ID, "failed", 0, 1500, 0, 0, nil)
+	jm.ResumeImportJob(sampled.ID)
+	current, _ = jm.GetImportJob(sampled.ID)
+	if current.ErrorRecords != 1200 || len(current.Errors) != 700 ||
+		current.Errors[errorSampleHead-1].Row != errorSampleHead || current.Errors[len(current.Errors)-1].Row != 1200 {
+		t.Errorf("Expected the first 500 errors and rows 1001-1200 after rollback, got count=%d sample=%d ending at row %d",
+			current.ErrorRecords, len(current.Errors), current.Errors[len(current.Errors)-1].Row)
+	}
+}
+
+func TestIdempotencyKeysFingerprintAndExpiry(t *testing.T) {
+	store := newMemoryStore()
+	im, err := NewIdempotencyManagerWithStore(store, time.Hour)
+	if err != nil {
+		t.Fatalf("NewIdempotencyManagerWithStore: %v", err)
+	}
+
+	fingerprint := RequestFingerprint("users", "csv", "false", "sha256:abc")
+	im.SetIdempotency("imports", "key-1", fingerprint, "job-1")
+
+	// A restarted manager still knows the key
+	im, err = NewIdempotencyManagerWithStore(store, time.Hour)
+	if err != nil {
+		t.Fatalf("NewIdempotencyManagerWithStore after restart: %v", err)
+	}
+	jobID, exists, err := im.CheckIdempotency("imports", "key-1", fingerprint)
+	if err != nil || !exists || jobID != "job-1" {
+		t.Fatalf("CheckIdempotency = %q, %v, %v; want job-1", jobID, exists, err)
+	}
+
+	// The same key with another file is rejected, but is free in the export scope
+	other := RequestFingerprint("users", "csv", "false", "sha256:def")
+	if _, _, err := im.CheckIdempotency("imports", "key-1", other); err != ErrIdempotencyKeyReused {
+		t.Fatalf("reused key error = %v, want ErrIdempotencyKeyReused", err)
+	}
+	if _, exists, err := im.CheckIdempotency("exports", "key-1", other); exists || err != nil {
+		t.Fatalf("export scope = %v, %v; want no match", exists, err)
+	}
+
+	// Expired keys are ignored and cleaned up, in memory and in the store
+	record := store.idempotencyKeys["imports/key-1"]
+	record.CreatedAt = time.Now().Add(-2 * time.Hour)
+	im.keys["imports/key-1"].CreatedAt = record.CreatedAt
+	store.idempotencyKeys["imports/key-1"] = record
+
+	if _, exists, err := im.CheckIdempotency("imports", "key-1", other); exists || err != nil {
+		t.Fatalf("expired key = %v, %v; want no match", exists, err)
+	}
+	im.CleanupIdempotencyKeys()
+	if len(im.keys) != 0 || len(store.idempotencyKeys) != 0 {
+		t.Fatalf("cleanup left %d keys in memory and %d in store", len(im.keys), len(store.idempotencyKeys))
+	}
+}
+
+func TestMappingProfilesPersistAndWarningsDeduplicate(t *testing.T) {
+	store := newMemoryStore()
+	pm, err := NewProfileManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("NewProfileManagerWithStore: %v", err)
+	}
+
+	saved, err := pm.SaveProfile(models.MappingProfile{
+		Name:         "crm",
+		ResourceType: "users",
+		Mapping:      map[string]string{"Email Address": "email"},
+	})
+	if err != nil {
+		t.Fatalf("SaveProfile: %v", err)
+	}
+	saved.Mapping["Full Name"] = "name" // callers get a copy
+
+	// Replacing a profile keeps its creation time; a restarted manager loads it
+	time.Sleep(time.Millisecond)
+	if _, err := pm.SaveProfile(models.MappingProfile{
+		Name:         "crm",
+		ResourceType: "users",
+		Mapping:      map[string]string{"Email Address": "email", "Is Enabled": "active"},
+	}); err != nil {
+		t.Fatalf("SaveProfile replace: %v", err)
+	}
+	pm, err = NewProfileManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("NewProfileManagerWithStore after restart: %v", err)
+	}
+	profile, exists := pm.GetProfile("crm")
+	if !exists || len(profile.Mapping) != 2 || !profile.CreatedAt.Equal(saved.CreatedAt) || !profile.UpdatedAt.After(saved.UpdatedAt) {
+		t.Fatalf("Unexpected profile after restart: %+v", profile)
+	}
+
+	if err := pm.DeleteProfile("crm"); err != nil || len(pm.ListProfiles()) != 0 || len(store.profiles) != 0 {
+		t.Fatalf("DeleteProfile = %v, left %d profiles", err, len(store.profiles))
+	}
+	if err := pm.DeleteProfile("crm"); err != ErrProfileNotFound {
+		t.Errorf("DeleteProfile of a missing profile = %v, want ErrProfileNotFound", err)
+	}
+
+	// Warnings are recorded once each and capped
+	jm := NewJobManager()
+	job := jm.CreateImportJob("users", "csv", "users.csv")
+	jm.AddImportWarnings(job.ID, "unmapped Phone", "unmapped Phone")
+	for i := 0; i < maxImportWarnings+10; i++ {
+		jm.AddImportWarnings(job.ID, fmt.Sprintf("warning %d", i))
+	}
+	current, _ := jm.GetImportJob(job.ID)
+	if len(current.Warnings) != maxImportWarnings || current.Warnings[0] != "unmapped Phone" {
+		t.Errorf("Expected %d warnings starting with the first, got %d", maxImportWarnings, len(current.Warnings))
+	}
+}
+
+// bundleProcessor imports the files of a bundle, failing the resource types in fail
+type bundleProcessor struct {
+	stubProcessor
+	jm       *JobManager
+	files    []models.BundleFile
+	fail     map[string]bool
+	imported []string
+}
+
+func (bp *bundleProcessor) ProcessImport(ctx context.Context, job *models.ImportJob) error {
+	bp.imported = append(bp.imported, job.ResourceType)
+	if bp.fail[job.ResourceType] {
+		return errors.New("database unavailable")
+	}
+	bp.jm.UpdateImportJob(job.ID, "completed", 100, 10, 8, 2, []models.ValidationError{{Row: 2}, {Row: 5}})
+	return nil
+}
+
+func (bp *bundleProcessor) ExtractBundle(archivePath, format, dir string) ([]models.BundleFile, error) {
+	return bp.files, nil
+}
+
+func TestBundleImportRunsStagesInDependencyOrder(t *testing.T) {
+	jm := NewJobManager()
+	processor := &bundleProcessor{
+		jm: jm,
+		files: []models.BundleFile{ // in archive order, not import order
+			{ResourceType: "comments", Format: "ndjson", Path: "comments.ndjson"},
+			{ResourceType: "users", Format: "csv", Path: "users.csv"},
+			{ResourceType: "articles", Format: "json", Path: "articles.json"},
+		},
+		fail: map[string]bool{"users": true},
+	}
+	jp := NewJobProcessor(jm, nil, processor, DefaultQueueConfig())
+
+	// A failed users stage stops the stages that depend on it
+	bundle := jm.CreateImportJob("bundle", "zip", filepath.Join(t.TempDir(), "dataset.zip"))
+	jp.ProcessImportJob(context.Background(), bundle.ID)
+
+	failed, _ := jm.GetImportJob(bundle.ID)
+	if failed.Status != "failed" || strings.Join(processor.imported, ",") != "users" {
+		t.Fatalf("Expected a failed bundle that only tried users, got %s after %v", failed.Status, processor.imported)
+	}
+	children := jm.ImportJobChildren(bundle.ID)
+	statuses := make([]string, 0, len(children))
+	for _, child := range children {
+		statuses = append(statuses, child.ResourceType+"="+child.Status)
+	}
+	if strings.Join(statuses, ",") != "users=failed,articles=cancelled,comments=cancelled" {
+		t.Errorf("Unexpected child results: %v", statuses)
+	}
+
+	// Resuming the bundle runs every stage in order once users succeeds
+	processor.fail = nil
+	processor.imported = nil
+	if _, err := jm.ResumeImportJob(bundle.ID); err != nil {
+		t.Fatalf("Expected bundle to be resumable, got: %v", err)
+	}
+	jp.ProcessImportJob(context.Background(), bundle.ID)
+
+	done, _ := jm.GetImportJob(bundle.ID)
+	if done.Status != "completed" || strings.Join(processor.imported, ",") != "users,articles,comments" {
+		t.Fatalf("Expected a completed bundle imported in FK order, got %s after %v", done.Status, processor.imported)
+	}
+	if done.TotalRecords != 30 || done.ValidRecords != 24 || done.ErrorRecords != 6 || len(jm.ImportJobChildren(bundle.ID)) != 3 {
+		t.Errorf("Expected counters summed over 3 children, got total=%d valid=%d errors=%d",
+			done.TotalRecords, done.ValidRecords, done.ErrorRecords)
+	}
+}
+
+func TestUploadSessionResumesAcrossRestartAndCompletes(t *testing.T) {
+	dir := t.TempDir()
+	store := newMemoryStore()
+	um, err := NewUploadManagerWithStore(store, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create upload manager: %v", err)
+	}
+
+	data := []byte(strings.Repeat("id,email\n,user@example.com\n", 10))
+	sum := sha256.Sum256(data)
+	session, err := um.CreateSession("../users.csv", int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if session.FileName != "users.csv" {
+		t.Errorf("Expected the file name to lose its directory, got %q", session.FileName)
+	}
+
+	if _, err := um.WriteChunk(session.ID, 0, 100, bytes.NewReader(data[:100])); err != nil {
+		t.Fatalf("Failed to write first chunk: %v", err)
+	}
+	if _, err := um.WriteChunk(session.ID, 0, 100, bytes.NewReader(data[:100])); !errors.Is(err, ErrUploadOffsetMismatch) {
+		t.Errorf("Expected a chunk at the wrong offset to be rejected, got %v", err)
+	}
+	if _, err := um.WriteChunk(session.ID, 100, int64(len(data)), bytes.NewReader(data[100:])); !errors.Is(err, ErrUploadPastSize) {
+		t.Errorf("Expected a chunk past the declared size to be rejected, got %v", err)
+	}
+
+	// A dropped connection keeps the bytes that arrived
+	current, err := um.WriteChunk(session.ID, 100, 100, bytes.NewReader(data[100:150]))
+	if err == nil || current.ReceivedBytes != 150 {
+		t.Fatalf("Expected an interrupted chunk to leave 150 bytes, got %+v and %v", current, err)
+	}
+
+	// Bytes written but not recorded before a restart are dropped
+	part, _ := os.OpenFile(filepath.Join(dir, "sessions", session.ID+".part"), os.O_APPEND|os.O_WRONLY, 0)
+	part.Write([]byte("garbage"))
+	part.Close()
+	um, err = NewUploadManagerWithStore(store, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to reload upload manager: %v", err)
+	}
+	if current, _ := um.GetSession(session.ID); current == nil || current.ReceivedBytes != 150 {
+		t.Fatalf("Expected the session to resume at 150 bytes, got %+v", current)
+	}
+
+	if _, err := um.CompleteSession(session.ID, hex.EncodeToString(sum[:])); !errors.Is(err, ErrUploadIncomplete) {
+		t.Errorf("Expected completing a partial upload to fail, got %v", err)
+	}
+	if _, err := um.WriteChunk(session.ID, 150, int64(len(data)-150), bytes.NewReader(data[150:])); err != nil {
+		t.Fatalf("Failed to write last chunk: %v", err)
+	}
+	completed, err := um.CompleteSession(session.ID, "sha256:"+hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("Failed to complete upload: %v", err)
+	}
+	if content, _ := os.ReadFile(completed.FilePath); !bytes.Equal(content, data) || filepath.Dir(completed.FilePath) != dir {
+		t.Errorf("Expected the completed file next to other uploads with the uploaded bytes, got %s", completed.FilePath)
+	}
+
+	if files := um.CompletedFiles(); !files[filepath.Clean(completed.FilePath)] {
+		t.Errorf("Expected the completed upload to be kept from file cleanup, got %v", files)
+	}
+	upload, err := um.ClaimUpload(session.ID)
+	if err != nil || upload.FilePath != completed.FilePath {
+		t.Fatalf("Expected the completed upload to be claimed, got %v", err)
+	}
+	if _, err := um.ClaimUpload(session.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Expected a claimed upload not to be claimed twice, got %v", err)
+	}
+	if _, exists := um.GetSession(session.ID); exists || len(store.uploads) != 0 {
+		t.Error("Expected a claimed upload to be forgotten")
+	}
+	if _, err := os.Stat(completed.FilePath); err != nil {
+		t.Errorf("Expected a claimed upload to keep its file for the import: %v", err)
+	}
+	um.ReturnUpload(upload)
+	if _, err := um.ClaimUpload(session.ID); err != nil || len(store.uploads) != 0 {
+		t.Errorf("Expected a returned upload to be claimable again, got %v", err)
+	}
+
+	// A file that doesn't match its checksum is discarded
+	mismatch, _ := um.CreateSession("users.csv", 3)
+	um.WriteChunk(mismatch.ID, 0, 3, strings.NewReader("abc"))
+	if _, err := um.CompleteSession(mismatch.ID, hex.EncodeToString(sum[:])); !errors.Is(err, ErrUploadChecksumMismatch) {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+	if _, exists := um.GetSession(mismatch.ID); exists {
+		t.Error("Expected a mismatched upload to be discarded")
+	}
+
+	// Abandoned sessions expire through cleanup along with their partial files
+	short := NewUploadManager(dir, time.Millisecond)
+	abandoned, _ := short.CreateSession("users.csv", 10)
+	time.Sleep(5 * time.Millisecond)
+	short.CleanupExpiredSessions()
+	if _, err := os.Stat(filepath.Join(dir, "sessions", abandoned.ID+".part")); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file of an expired session to be removed, got %v", err)
+	}
+}
+
+// fileProcessor records the content of the file each import job starts with
+type fileProcessor struct {
+	stubProcessor
+	jm       *JobManager
+	contents []string
+}
+
+func (fp *fileProcessor) ProcessImport(ctx context.Context, job *models.ImportJob) error {
+	content, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		return err
+	}
+	fp.contents = append(fp.contents, string(content))
+	fp.jm.UpdateImportJob(job.ID, "completed", 100, 1, 1, 0, nil)
+	return nil
+}
+
+func (fp *fileProcessor) ProcessImportStream(ctx context.Context, job *models.ImportJob, body io.Reader, size int64) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	fp.contents = append(fp.contents, string(content))
+	fp.jm.UpdateImportJob(job.ID, "completed", 100, 1, 1, 0, nil)
+	return nil
+}
+
+func (fp *fileProcessor) CheckMapping(ctx context.Context, filePath, resourceType, format string, options models.ImportOptions) ([]string, error) {
+	return []string{"column 'nickname' is not mapped to any field and will be ignored"}, nil
+}
+
+func TestImportJobDownloadsRemoteSourceBeforeProcessing(t *testing.T) {
+	const content = "email,name\nann@example.com,Ann\n"
+	sum := sha256.Sum256([]byte(content))
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		if len(authorization) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	config := fetch.DefaultConfig()
+	config.AllowPrivateNetworks = true
+	config.RetryBackoff = time.Millisecond
+	config.Credentials = map[string]map[string]string{"partner": {"Authorization": "Bearer token"}}
+
+	jm := NewJobManager()
+	processor := &fileProcessor{jm: jm}
+	jp := NewJobProcessor(jm, nil, processor, DefaultQueueConfig())
+	jp.SetFetcher(fetch.New(config))
+
+	filePath := filepath.Join(t.TempDir(), "download_1.csv")
+	job := jm.CreateImportJob("users", "csv", filePath)
+	jm.SetImportSource(job.ID, models.RemoteSource{
+		URL:        server.URL + "/users.csv",
+		Headers:    map[string]string{"X-Request-Source": "test"},
+		Credential: "partner",
+		Checksum:   "sha256:" + hex.EncodeToString(sum[:]),
+	})
+	jp.ProcessImportJob(context.Background(), job.ID)
+
+	final, _ := jm.GetImportJob(job.ID)
+	if final.Status != "completed" || len(processor.contents) != 1 || processor.contents[0] != content {
+		t.Fatalf("Expected the downloaded file to be imported, got status %s and %q", final.Status, processor.contents)
+	}
+	events, _, unsubscribe, _ := jm.SubscribeImportJob(job.ID, 0)
+	unsubscribe()
+	var statuses []string
+	for _, event := range events {
+		if event.Type == EventStatus {
+			statuses = append(statuses, event.Data.(models.ImportJobSummary).Status)
+		}
+	}
+	if strings.Join(statuses, ",") != "downloading,processing,completed" {
+		t.Errorf("Expected the job to download before processing, got statuses %v", statuses)
+	}
+	if len(authorization) != 2 || authorization[1] != "Bearer token" {
+		t.Errorf("Expected a retry sending the credential, got %q", authorization)
+	}
+	if final.Source.BytesFetched != int64(len(content)) || final.Source.Attempts != 2 || !final.Source.Downloaded {
+		t.Errorf("Expected the download to be recorded on the job, got %+v", final.Source)
+	}
+	if final.SourceDigest != final.Source.Checksum {
+		t.Errorf("Expected the digest of the downloaded file on the job, got %q", final.SourceDigest)
+	}
+	if len(final.Warnings) != 1 {
+		t.Errorf("Expected the mapping to be checked once the file arrived, got %q", final.Warnings)
+	}
+}
+
+func TestStreamedImportJobRunsWithoutWorkerAndCleansUpSpoolFile(t *testing.T) {
+	jm := NewJobManager()
+	processor := &fileProcessor{jm: jm}
+	jp := NewJobProcessor(jm, nil, processor, DefaultQueueConfig()) // never started, so no worker is free
+
+	// Streams are bounded by slots of their own, as many as the import workers
+	var releases []func()
+	for i := 0; i < DefaultQueueConfig().ImportWorkers; i++ {
+		release, ok := jp.AcquireImportStreamSlot()
+		if !ok {
+			t.Fatalf("Expected stream slot %d to be free", i+1)
+		}
+		releases = append(releases, release)
+	}
+	if _, ok := jp.AcquireImportStreamSlot(); ok {
+		t.Error("Expected no stream slot beyond the import workers")
+	}
+	for _, release := range releases {
+		release()
+	}
+
+	// A body spooled to disk is resumable from the file, which goes once the job completes
+	spoolPath := filepath.Join(t.TempDir(), "stream_1.part")
+	os.WriteFile(spoolPath, []byte("{}\n"), 0644)
+	job := jm.CreateImportJob("users", "ndjson", "")
+	if job.FileName != "" {
+		t.Errorf("Expected a streamed import to have no file name, got %q", job.FileName)
+	}
+	jm.SetImportFilePath(job.ID, spoolPath)
+	if !jp.ProcessImportStream(context.Background(), job.ID, strings.NewReader("{}\n"), 3) {
+		t.Fatal("Expected the streamed import to complete")
+	}
+	if len(processor.contents) != 1 || processor.contents[0] != "{}\n" {
+		t.Errorf("Expected the body to be imported, got %q", processor.contents)
+	}
+	if _, err := os.Stat(spoolPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the spool file of a completed import to be removed, got %v", err)
+	}
+
+	// A spooled job interrupted by a restart resumes from its spool file
+	store := newMemoryStore()
+	persisted, _ := NewJobManagerWithStore(store)
+	spilled := persisted.CreateImportJob("users", "ndjson", "")
+	persisted.UpdateImportJob(spilled.ID, "processing", 10, 0, 0, 0, nil)
+	spoolPath = filepath.Join(t.TempDir(), "stream_2.part")
+	os.WriteFile(spoolPath, []byte("{}\n"), 0644)
+	persisted.SetImportFilePath(spilled.ID, spoolPath)
+
+	restarted, err := NewJobManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("Failed to reload jobs: %v", err)
+	}
+	restarted.RecoverInterruptedJobs()
+	if recovered, _ := restarted.GetImportJob(spilled.ID); recovered.Status != "failed" || recovered.FilePath != spoolPath {
+		t.Fatalf("Expected the interrupted job to fail with its spool file, got %s and %q", recovered.Status, recovered.FilePath)
+	}
+	restartedProcessor := NewJobProcessor(restarted, nil, &fileProcessor{jm: restarted}, DefaultQueueConfig())
+	if resumed, err := restartedProcessor.ResumeImportJob(spilled.ID); err != nil || resumed.Status != "pending" {
+		t.Errorf("Expected the spooled job to resume, got %v", err)
+	}
+
+	// A body that never reached a spool file can't be read again
+	unspooled := jm.CreateImportJob("users", "ndjson", "")
+	jm.UpdateImportJob(unspooled.ID, "failed", 40, 0, 0, 0, nil)
+	if _, err := jp.ResumeImportJob(unspooled.ID); !errors.Is(err, ErrSourceFileMissing) {
+		t.Errorf("Expected ErrSourceFileMissing for a streamed import without a spool file, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// ProfileManager keeps the saved column mapping profiles imports can refer to by name
+type ProfileManager struct {
+	profiles map[string]*models.MappingProfile
+	store    ProfileStore // optional; nil keeps profiles in memory only
+	mutex    sync.RWMutex
+}
+
+// NewProfileManager creates an in-memory profile manager
+func NewProfileManager() *ProfileManager {
+	return &ProfileManager{
+		profiles: make(map[string]*models.MappingProfile),
+	}
+}
+
+// NewProfileManagerWithStore creates a profile manager backed by a persistent
+// store, loading the profiles saved so far
+func NewProfileManagerWithStore(store ProfileStore) (*ProfileManager, error) {
+	pm := NewProfileManager()
+	pm.store = store
+
+	profiles, err := store.LoadMappingProfiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mapping profiles: %w", err)
+	}
+	for _, profile := range profiles {
+		pm.profiles[profile.Name] = profile
+	}
+	return pm, nil
+}
+
+// SaveProfile creates a profile or replaces the one with the same name
+func (pm *ProfileManager) SaveProfile(profile models.MappingProfile) (*models.MappingProfile, error) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	now := time.Now()
+	profile.Mapping = maps.Clone(profile.Mapping)
+	profile.CreatedAt = now
+	if existing, exists := pm.profiles[profile.Name]; exists {
+		profile.CreatedAt = existing.CreatedAt
+	}
+	profile.UpdatedAt = now
+
+	if pm.store != nil {
+		if err := pm.store.SaveMappingProfile(&profile); err != nil {
+			return nil, fmt.Errorf("failed to save mapping profile: %w", err)
+		}
+	}
+	pm.profiles[profile.Name] = &profile
+	return copyProfile(&profile), nil
+}
+
+// GetProfile returns the profile with the given name
+func (pm *ProfileManager) GetProfile(name string) (*models.MappingProfile, bool) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	profile, exists := pm.profiles[name]
+	if !exists {
+		return nil, false
+	}
+	return copyProfile(profile), true
+}
+
+// ListProfiles returns every profile, sorted by name
+func (pm *ProfileManager) ListProfiles() []*models.MappingProfile {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	profiles := make([]*models.MappingProfile, 0, len(pm.profiles))
+	for _, profile := range pm.profiles {
+		profiles = append(profiles, copyProfile(profile))
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// DeleteProfile removes a profile. Jobs created with it keep their own copy
+// of its mapping.
+func (pm *ProfileManager) DeleteProfile(name string) error {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if _, exists := pm.profiles[name]; !exists {
+		return ErrProfileNotFound
+	}
+	if pm.store != nil {
+		if err := pm.store.DeleteMappingProfile(name); err != nil {
+			return fmt.Errorf("failed to delete mapping profile: %w", err)
+		}
+	}
+	delete(pm.profiles, name)
+	return nil
+}
+
+// copyProfile returns a copy of a profile that callers may modify
+func copyProfile(profile *models.MappingProfile) *models.MappingProfile {
+	profileCopy := *profile
+	profileCopy.Mapping = maps.Clone(profile.Mapping)
+	return &profileCopy
+}
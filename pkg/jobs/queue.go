@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when a job queue has no room for another job
+var ErrQueueFull = errors.New("job queue is full")
+
+// QueueConfig controls the worker pools that run import and export jobs
+type QueueConfig struct {
+	ImportWorkers   int
+	ExportWorkers   int
+	ImportQueueSize int
+	ExportQueueSize int
+}
+
+// DefaultQueueConfig returns the queue settings used when none are configured
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		ImportWorkers:   4,
+		ExportWorkers:   2,
+		ImportQueueSize: 100,
+		ExportQueueSize: 100,
+	}
+}
+
+// queuedJob is a unit of work waiting for a worker
+type queuedJob struct {
+	id  string
+	run func(ctx context.Context)
+}
+
+// jobQueue is a bounded FIFO queue of jobs served by a fixed number of workers
+type jobQueue struct {
+	pending  []queuedJob
+	capacity int
+	mutex    sync.Mutex
+	cond     *sync.Cond
+}
+
+// newJobQueue creates a queue that holds at most capacity waiting jobs
+func newJobQueue(capacity int) *jobQueue {
+	q := &jobQueue{
+		pending:  make([]queuedJob, 0, capacity),
+		capacity: capacity,
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+// start launches the given number of workers that drain the queue
+func (q *jobQueue) start(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				job := q.pop()
+				job.run(context.Background())
+			}
+		}()
+	}
+}
+
+// push appends a job to the queue, failing with ErrQueueFull when at capacity
+func (q *jobQueue) push(job queuedJob) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.pending) >= q.capacity {
+		return ErrQueueFull
+	}
+
+	q.pending = append(q.pending, job)
+	q.cond.Signal()
+	return nil
+}
+
+// pop blocks until a job is available and removes it from the queue
+func (q *jobQueue) pop() queuedJob {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.pending) == 0 {
+		q.cond.Wait()
+	}
+
+	job := q.pending[0]
+	q.pending = q.pending[1:]
+	return job
+}
+
+// full reports whether the queue is at capacity
+func (q *jobQueue) full() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.pending) >= q.capacity
+}
+
+// position returns the 1-based position of a job in the queue, or 0 if it is not queued
+func (q *jobQueue) position(id string) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, job := range q.pending {
+		if job.id == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// remove drops a waiting job from the queue and reports whether it was queued
+func (q *jobQueue) remove(id string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, job := range q.pending {
+		if job.id == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// JobStore persists import and export jobs so they survive process restarts
+type JobStore interface {
+	SaveImportJob(job *models.ImportJob) error
+	SaveExportJob(job *models.ExportJob) error
+	LoadImportJobs() ([]*models.ImportJob, error)
+	LoadExportJobs() ([]*models.ExportJob, error)
+	DeleteJobsBefore(cutoff time.Time) error
+}
+
+// IdempotencyStore persists idempotency keys so retries are recognised across restarts
+type IdempotencyStore interface {
+	SaveIdempotencyKey(key *models.IdempotencyKey) error
+	LoadIdempotencyKeys() ([]*models.IdempotencyKey, error)
+	DeleteIdempotencyKeysBefore(cutoff time.Time) error
+}
+
+// ProfileStore persists column mapping profiles
+type ProfileStore interface {
+	SaveMappingProfile(profile *models.MappingProfile) error
+	LoadMappingProfiles() ([]*models.MappingProfile, error)
+	DeleteMappingProfile(name string) error
+}
+
+// UploadStore persists chunked upload sessions so uploads can resume across restarts
+type UploadStore interface {
+	SaveUploadSession(session *models.UploadSession) error
+	LoadUploadSessions() ([]*models.UploadSession, error)
+	DeleteUploadSession(id string) error
+}
@@ -0,0 +1,425 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// DefaultUploadSessionTTL is how long an upload session is kept after its last chunk
+const DefaultUploadSessionTTL = 24 * time.Hour
+
+// DefaultMaxUploadSize caps the size a chunked upload may declare
+const DefaultMaxUploadSize int64 = 10 << 30 // 10GB
+
+var (
+	// ErrUploadNotFound is returned for an unknown or expired upload session
+	ErrUploadNotFound = errors.New("upload session not found")
+	// ErrUploadTooLarge is returned when a session declares more than the size limit
+	ErrUploadTooLarge = errors.New("upload exceeds the maximum size")
+	// ErrUploadOffsetMismatch is returned when a chunk doesn't start where the received bytes end
+	ErrUploadOffsetMismatch = errors.New("chunk does not start at the received offset")
+	// ErrUploadPastSize is returned when a chunk reaches past the declared size
+	ErrUploadPastSize = errors.New("chunk extends past the declared upload size")
+	// ErrUploadBusy is returned while another request is writing to or completing the session
+	ErrUploadBusy = errors.New("upload session is busy with another request")
+	// ErrUploadCompleted is returned when a completed session gets another chunk
+	ErrUploadCompleted = errors.New("upload session is already completed")
+	// ErrUploadIncomplete is returned when a session is completed before every byte arrived,
+	// or an import refers to a session that isn't completed
+	ErrUploadIncomplete = errors.New("upload session has not received every byte")
+	// ErrUploadChecksumMismatch is returned when the received file doesn't match its checksum
+	ErrUploadChecksumMismatch = errors.New("upload checksum does not match the received file")
+)
+
+// UploadManager keeps the sessions of files uploaded in chunks. Chunks are
+// appended to a partial file in the sessions directory; a completed upload is
+// moved next to the other uploads, where an import job can use it.
+type UploadManager struct {
+	sessions    map[string]*models.UploadSession
+	busy        map[string]bool // sessions a request is writing to or completing
+	store       UploadStore     // optional; nil keeps sessions in memory only
+	uploadsDir  string
+	sessionsDir string // partial files of open sessions
+	ttl         time.Duration
+	maxSize     int64
+	mutex       sync.Mutex
+}
+
+// NewUploadManager creates an in-memory upload manager whose sessions expire
+// ttl after their last chunk
+func NewUploadManager(uploadsDir string, ttl time.Duration) *UploadManager {
+	if ttl <= 0 {
+		ttl = DefaultUploadSessionTTL
+	}
+	return &UploadManager{
+		sessions:    make(map[string]*models.UploadSession),
+		busy:        make(map[string]bool),
+		uploadsDir:  uploadsDir,
+		sessionsDir: filepath.Join(uploadsDir, "sessions"),
+		ttl:         ttl,
+		maxSize:     DefaultMaxUploadSize,
+	}
+}
+
+// NewUploadManagerWithStore creates an upload manager backed by a persistent
+// store, loading the sessions saved so far. Bytes of a partial file that were
+// written but not recorded, because the process stopped mid-chunk, are dropped
+// so the client resends them.
+func NewUploadManagerWithStore(store UploadStore, uploadsDir string, ttl time.Duration) (*UploadManager, error) {
+	um := NewUploadManager(uploadsDir, ttl)
+	um.store = store
+
+	sessions, err := store.LoadUploadSessions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if session.Status == "open" {
+			info, err := os.Stat(session.FilePath)
+			if err != nil {
+				continue // the partial file is gone; the session expires with cleanup
+			}
+			if info.Size() > session.ReceivedBytes {
+				if err := os.Truncate(session.FilePath, session.ReceivedBytes); err != nil {
+					log.Printf("Failed to truncate upload %s: %v", session.ID, err)
+				}
+			} else {
+				session.ReceivedBytes = info.Size()
+			}
+		}
+		um.sessions[session.ID] = session
+	}
+	return um, nil
+}
+
+// SetMaxUploadSize sets the largest size an upload session may declare
+func (um *UploadManager) SetMaxUploadSize(size int64) {
+	um.maxSize = size
+}
+
+// CreateSession starts an upload of a file of the given size
+func (um *UploadManager) CreateSession(fileName string, size int64) (*models.UploadSession, error) {
+	if size > um.maxSize {
+		return nil, ErrUploadTooLarge
+	}
+	if err := os.MkdirAll(um.sessionsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	now := time.Now()
+	session := &models.UploadSession{
+		ID:        uuid.New().String(),
+		FileName:  filepath.Base(fileName),
+		Size:      size,
+		Status:    "open",
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(um.ttl),
+	}
+	session.FilePath = filepath.Join(um.sessionsDir, session.ID+".part")
+	file, err := os.Create(session.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	um.sessions[session.ID] = session
+	um.persistSession(session)
+	sessionCopy := *session
+	return &sessionCopy, nil
+}
+
+// GetSession returns an upload session
+func (um *UploadManager) GetSession(id string) (*models.UploadSession, bool) {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	session, exists := um.sessions[id]
+	if !exists || um.expired(session) {
+		return nil, false
+	}
+	sessionCopy := *session
+	return &sessionCopy, true
+}
+
+// WriteChunk appends length bytes read from chunk to an upload, which must
+// start at the offset received so far. When the chunk ends early, the bytes
+// that did arrive are kept and the session reports the new offset to resume from.
+func (um *UploadManager) WriteChunk(id string, offset, length int64, chunk io.Reader) (*models.UploadSession, error) {
+	session, err := um.acquire(id)
+	if err != nil {
+		return session, err
+	}
+	if session.Status != "open" {
+		um.release(id)
+		return session, ErrUploadCompleted
+	}
+	if offset != session.ReceivedBytes {
+		um.release(id)
+		return session, ErrUploadOffsetMismatch
+	}
+	if offset+length > session.Size {
+		um.release(id)
+		return session, ErrUploadPastSize
+	}
+
+	written, writeErr := appendChunk(session.FilePath, offset, length, chunk)
+
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+	delete(um.busy, id)
+
+	current, exists := um.sessions[id]
+	if !exists {
+		return nil, ErrUploadNotFound
+	}
+	if written > 0 {
+		current.ReceivedBytes += written
+		current.UpdatedAt = time.Now()
+		current.ExpiresAt = current.UpdatedAt.Add(um.ttl)
+		um.persistSession(current)
+	}
+	sessionCopy := *current
+	if writeErr != nil {
+		return &sessionCopy, fmt.Errorf("chunk ended after %d of %d bytes: %w", written, length, writeErr)
+	}
+	return &sessionCopy, nil
+}
+
+// appendChunk writes a chunk at offset, first dropping anything past it that
+// an interrupted request left behind
+func appendChunk(path string, offset, length int64, chunk io.Reader) (int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	written, err := io.CopyN(file, chunk, length)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return written, err
+}
+
+// CompleteSession checks a fully received upload against its sha256 checksum
+// and moves it next to the other uploads. An upload that doesn't match is
+// discarded, since its bytes can't be replaced.
+func (um *UploadManager) CompleteSession(id, checksum string) (*models.UploadSession, error) {
+	session, err := um.acquire(id)
+	if err != nil {
+		return session, err
+	}
+	if session.Status != "open" {
+		um.release(id)
+		return session, ErrUploadCompleted
+	}
+	if session.ReceivedBytes != session.Size {
+		um.release(id)
+		return session, ErrUploadIncomplete
+	}
+
+	sum, err := fileChecksum(session.FilePath)
+	if err != nil {
+		um.release(id)
+		return session, fmt.Errorf("failed to hash upload: %w", err)
+	}
+	if !strings.EqualFold(strings.TrimPrefix(checksum, "sha256:"), sum) {
+		um.mutex.Lock()
+		defer um.mutex.Unlock()
+		delete(um.busy, id)
+		um.removeSession(id, true)
+		return session, ErrUploadChecksumMismatch
+	}
+
+	filePath := filepath.Join(um.uploadsDir, fmt.Sprintf("%d_%s_%s", time.Now().Unix(), id[:8], session.FileName))
+	if err := os.Rename(session.FilePath, filePath); err != nil {
+		um.release(id)
+		return session, fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+	delete(um.busy, id)
+
+	current, exists := um.sessions[id]
+	if !exists {
+		return nil, ErrUploadNotFound
+	}
+	current.Status = "completed"
+	current.Checksum = sum
+	current.FilePath = filePath
+	current.UpdatedAt = time.Now()
+	current.ExpiresAt = current.UpdatedAt.Add(um.ttl)
+	um.persistSession(current)
+	sessionCopy := *current
+	return &sessionCopy, nil
+}
+
+// fileChecksum returns the hex encoded sha256 of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ClaimUpload hands the file of a completed upload to an import job,
+// forgetting the session in the same step so no other import can claim it.
+// ReturnUpload puts the session back if the job isn't created after all.
+func (um *UploadManager) ClaimUpload(id string) (*models.UploadSession, error) {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	session, exists := um.sessions[id]
+	if !exists || um.expired(session) {
+		return nil, ErrUploadNotFound
+	}
+	sessionCopy := *session
+	if um.busy[id] {
+		return &sessionCopy, ErrUploadBusy
+	}
+	if session.Status != "completed" {
+		return &sessionCopy, ErrUploadIncomplete
+	}
+	um.removeSession(id, false)
+	return &sessionCopy, nil
+}
+
+// ReturnUpload restores a claimed upload whose import job wasn't created, so
+// it can be used for another try
+func (um *UploadManager) ReturnUpload(session *models.UploadSession) {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	um.sessions[session.ID] = session
+	um.persistSession(session)
+}
+
+// DeleteSession abandons an upload, removing whatever it received
+func (um *UploadManager) DeleteSession(id string) error {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	if _, exists := um.sessions[id]; !exists {
+		return ErrUploadNotFound
+	}
+	if um.busy[id] {
+		return ErrUploadBusy
+	}
+	um.removeSession(id, true)
+	return nil
+}
+
+// CleanupExpiredSessions removes sessions that outlived their TTL, unfinished
+// or never used by an import, along with their files
+func (um *UploadManager) CleanupExpiredSessions() {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	for id, session := range um.sessions {
+		if um.expired(session) && !um.busy[id] {
+			um.removeSession(id, true)
+		}
+	}
+}
+
+// CompletedFiles returns the files of completed uploads not yet used by an
+// import. They live beside other uploads, but expire with their session.
+func (um *UploadManager) CompletedFiles() map[string]bool {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	files := make(map[string]bool)
+	for _, session := range um.sessions {
+		if session.Status == "completed" {
+			files[filepath.Clean(session.FilePath)] = true
+		}
+	}
+	return files
+}
+
+// acquire marks a session busy for a request; release clears the mark
+func (um *UploadManager) acquire(id string) (*models.UploadSession, error) {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	session, exists := um.sessions[id]
+	if !exists || um.expired(session) {
+		return nil, ErrUploadNotFound
+	}
+	sessionCopy := *session
+	if um.busy[id] {
+		return &sessionCopy, ErrUploadBusy
+	}
+	um.busy[id] = true
+	return &sessionCopy, nil
+}
+
+func (um *UploadManager) release(id string) {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+	delete(um.busy, id)
+}
+
+// removeSession forgets a session, and its file unless an import now owns it;
+// callers must hold the mutex
+func (um *UploadManager) removeSession(id string, removeFile bool) {
+	session, exists := um.sessions[id]
+	if !exists {
+		return
+	}
+	if removeFile {
+		os.Remove(session.FilePath)
+	}
+	delete(um.sessions, id)
+
+	if um.store != nil {
+		if err := um.store.DeleteUploadSession(id); err != nil {
+			log.Printf("Failed to delete upload session %s from store: %v", id, err)
+		}
+	}
+}
+
+// persistSession writes a session to the store, if there is one; callers must hold the mutex
+func (um *UploadManager) persistSession(session *models.UploadSession) {
+	if um.store == nil {
+		return
+	}
+	if err := um.store.SaveUploadSession(session); err != nil {
+		log.Printf("Failed to persist upload session %s: %v", session.ID, err)
+	}
+}
+
+// expired reports whether a session has outlived its TTL; callers must hold the mutex
+func (um *UploadManager) expired(session *models.UploadSession) bool {
+	return time.Now().After(session.ExpiresAt)
+}
@@ -0,0 +1,260 @@
+// Package s3 reads and writes objects in S3-compatible stores, such as AWS S3
+// and MinIO. Objects are streamed in both directions rather than staged on disk.
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the size of the parts an upload is sent in; S3 needs
+// every part but the last to be at least 5MB
+const DefaultPartSize = 8 * 1024 * 1024
+
+var (
+	// ErrNotFound is returned when a bucket or object does not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidURL is returned for a URL that is not s3://bucket/key
+	ErrInvalidURL = errors.New("S3 URL must look like s3://bucket/key")
+)
+
+// bucketName matches the bucket names S3 accepts, which also keeps them safe in a host name
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// unsignedPayload stands in for the hash of a body that is streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Config locates an object store and the credentials to sign requests with
+type Config struct {
+	Endpoint        string // such as http://localhost:9000; AWS S3 in Region when empty
+	Region          string
+	AccessKeyID     string // requests are sent unsigned when empty, for public buckets
+	SecretAccessKey string
+	SessionToken    string
+	PathStyle       bool  // address buckets as endpoint/bucket rather than bucket.endpoint, as MinIO needs
+	PartSize        int64 // DefaultPartSize when zero
+}
+
+// Client sends requests to an object store
+type Client struct {
+	config   Config
+	endpoint *url.URL
+	http     *http.Client
+}
+
+// APIError is an error answer from the object store
+type APIError struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 request failed with HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("S3 request failed with HTTP %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// New creates a client for the store described by config
+func New(config Config) (*Client, error) {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = DefaultPartSize
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3 endpoint must be an http or https URL, got %q", config.Endpoint)
+	}
+	return &Client{
+		config:   config,
+		endpoint: endpoint,
+		http:     &http.Client{Timeout: 0}, // bodies stream for as long as an import or export runs
+	}, nil
+}
+
+// IsURL reports whether a file location is an s3:// URL rather than a local path or http URL
+func IsURL(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+// ParseURL splits s3://bucket/key into its bucket and key
+func ParseURL(rawURL string) (bucket, key string, err error) {
+	rest, found := strings.CutPrefix(rawURL, "s3://")
+	if !found {
+		return "", "", ErrInvalidURL
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if !bucketName.MatchString(bucket) || key == "" {
+		return "", "", ErrInvalidURL
+	}
+	return bucket, key, nil
+}
+
+// newRequest builds a signed request for an object, or for the bucket when key is empty
+func (c *Client) newRequest(ctx context.Context, method, bucket, key string, query url.Values, body io.Reader, payloadHash string) (*http.Request, error) {
+	target := *c.endpoint
+	objectPath := "/" + key
+	if c.config.PathStyle {
+		objectPath = "/" + bucket + objectPath
+	} else {
+		target.Host = bucket + "." + target.Host
+	}
+	target.Path = strings.TrimSuffix(c.endpoint.Path, "/") + objectPath
+	target.RawPath = uriEncode(target.Path, false)
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return req, nil
+}
+
+// do signs and sends a request, turning error answers into an APIError
+func (c *Client) do(req *http.Request, expected ...int) (*http.Response, error) {
+	c.sign(req, time.Now().UTC())
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, readError(resp)
+}
+
+// readError decodes the error document of a failed request
+func readError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(body, apiErr)
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %v", ErrNotFound, apiErr)
+	}
+	return apiErr
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to a request
+func (c *Client) sign(req *http.Request, now time.Time) {
+	if c.config.AccessKeyID == "" {
+		return
+	}
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.config.SessionToken)
+	}
+
+	canonical, signedHeaders := canonicalRequest(req)
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", amzDate[:8], c.config.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonical)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), amzDate[:8])
+	for _, part := range []string{c.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalRequest returns the canonical form of a request that is signed,
+// and the names of the headers it covers
+func canonicalRequest(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" || lower == "content-md5" || lower == "content-type" || lower == "if-match" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n"), signedHeaders
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signing requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and slashes
+// unless encodeSlash is set
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
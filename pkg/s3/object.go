@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Object is an object read in place from the store. Sequential reads stream
+// one ranged GET from the current offset; ReadAt makes a request of its own,
+// for the few reads that jump around, such as sniffing a file or finding the
+// directory of a zip archive.
+type Object struct {
+	client *Client
+	ctx    context.Context
+	bucket string
+	key    string
+	size   int64
+	etag   string // reads ask for this version, so an object replaced mid-import fails the reads
+	offset int64
+	body   io.ReadCloser
+}
+
+// Open looks up the object at an s3:// URL and returns a reader for it
+func (c *Client) Open(ctx context.Context, rawURL string) (*Object, error) {
+	bucket, key, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, http.MethodHead, bucket, key, nil, nil, unsignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return &Object{
+		client: c,
+		ctx:    ctx,
+		bucket: bucket,
+		key:    key,
+		size:   resp.ContentLength,
+		etag:   resp.Header.Get("ETag"),
+	}, nil
+}
+
+// Size returns the size of the object in bytes
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.get(o.offset, o.size-1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if errors.Is(err, io.EOF) && o.offset < o.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek moves the offset sequential reads start from. The open GET is dropped
+// only when the offset actually changes.
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return o.offset, fmt.Errorf("seek to negative offset %d", offset)
+	}
+	if offset != o.offset {
+		o.closeBody()
+		o.offset = offset
+	}
+	return o.offset, nil
+}
+
+func (o *Object) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p)) - 1
+	if end >= o.size {
+		end = o.size - 1
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	body, err := o.get(off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close ends the open GET, if any
+func (o *Object) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *Object) closeBody() {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+}
+
+// get requests the bytes of the object from start to end inclusive
+func (o *Object) get(start, end int64) (io.ReadCloser, error) {
+	req, err := o.client.newRequest(o.ctx, http.MethodGet, o.bucket, o.key, nil, nil, unsignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+	if o.etag != "" {
+		req.Header.Set("If-Match", o.etag)
+	}
+	resp, err := o.client.do(req, http.StatusPartialContent, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK && start > 0 {
+		// A store that ignores Range sends the whole object, which is no use here
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 store ignored the Range of a read at offset %d", start)
+	}
+	return resp.Body, nil
+}
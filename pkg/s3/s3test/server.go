@@ -0,0 +1,191 @@
+// Package s3test runs an in-memory S3-compatible server, addressed path-style
+// like MinIO, for tests of code that reads and writes objects
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is an object store holding its objects in memory. It implements
+// HEAD, ranged GET, PUT, DELETE and multipart uploads, which is what the s3
+// package uses.
+type Server struct {
+	*httptest.Server
+	AccessKeyID string // requests must be signed with this key
+
+	mutex   sync.Mutex
+	objects map[string][]byte // "bucket/key" -> content
+	uploads map[string]map[int][]byte
+	nextID  int
+	parts   int // parts received by multipart uploads
+}
+
+// NewServer starts a server that accepts requests signed with accessKeyID
+func NewServer(accessKeyID string) *Server {
+	s := &Server{
+		AccessKeyID: accessKeyID,
+		objects:     make(map[string][]byte),
+		uploads:     make(map[string]map[int][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Put stores an object
+func (s *Server) Put(bucket, key string, content []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[bucket+"/"+key] = content
+}
+
+// Object returns the content of an object
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	content, exists := s.objects[bucket+"/"+key]
+	return content, exists
+}
+
+// Parts returns how many parts multipart uploads have sent
+func (s *Server) Parts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.parts
+}
+
+// Uploads returns how many multipart uploads are in progress
+func (s *Server) Uploads() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied.")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, exists := s.uploads[query.Get("uploadId")]
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		body, _ := io.ReadAll(r.Body)
+		parts[number] = body
+		s.parts++
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, exists := s.uploads[query.Get("uploadId")]
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+			return
+		}
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+			return
+		}
+		var content []byte
+		for _, part := range complete.Parts {
+			data, exists := parts[part.PartNumber]
+			if !exists || etag(data) != part.ETag {
+				writeError(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+				return
+			}
+			content = append(content, data...)
+		}
+		s.objects[name] = content
+		delete(s.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[name] = body
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, exists := s.objects[name]
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != etag(content) {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+		w.Header().Set("ETag", etag(content))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		start, end, ranged := parseRange(r.Header.Get("Range"), len(content))
+		if !ranged {
+			w.WriteHeader(http.StatusOK)
+			if r.Method == http.MethodGet {
+				w.Write(content)
+			}
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : end+1])
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented")
+	}
+}
+
+// parseRange parses "bytes=<start>-<end>", clamping end to the content
+func parseRange(header string, size int) (int, int, bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return 0, 0, false
+	}
+	startPart, endPart, _ := strings.Cut(spec, "-")
+	start, err := strconv.Atoi(startPart)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if e, err := strconv.Atoi(endPart); err == nil && e < end {
+		end = e
+	}
+	return start, end, true
+}
+
+func etag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
@@ -0,0 +1,192 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Upload writes an object to the store as it is produced. Writes collect in a
+// buffer of one part, which is sent whenever it fills, so memory use stays at
+// the part size however large the object grows. An object smaller than one
+// part is sent with a single PUT when the upload is closed.
+type Upload struct {
+	client   *Client
+	ctx      context.Context
+	bucket   string
+	key      string
+	buffer   bytes.Buffer
+	uploadID string // set once the first part is sent
+	parts    []completedPart
+	err      error
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// Create starts writing the object at an s3:// URL. Nothing is visible in the
+// store until Close succeeds; Abort discards what was written.
+func (c *Client) Create(ctx context.Context, rawURL string) (*Upload, error) {
+	bucket, key, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Upload{client: c, ctx: ctx, bucket: bucket, key: key}, nil
+}
+
+func (u *Upload) Write(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	written := 0
+	for len(p) > 0 {
+		room := int(u.client.config.PartSize) - u.buffer.Len()
+		chunk := p[:min(room, len(p))]
+		u.buffer.Write(chunk)
+		written += len(chunk)
+		p = p[len(chunk):]
+
+		if u.buffer.Len() >= int(u.client.config.PartSize) {
+			if u.err = u.sendPart(); u.err != nil {
+				return written, u.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close sends what is left and completes the object
+func (u *Upload) Close() error {
+	if u.err != nil {
+		return u.err
+	}
+	if u.uploadID == "" {
+		u.err = u.putObject()
+		return u.err
+	}
+	if u.buffer.Len() > 0 {
+		if u.err = u.sendPart(); u.err != nil {
+			return u.err
+		}
+	}
+	u.err = u.complete()
+	return u.err
+}
+
+// Abort discards the parts sent so far
+func (u *Upload) Abort() error {
+	if u.err == nil {
+		u.err = errors.New("upload aborted")
+	}
+	if u.uploadID == "" {
+		return nil
+	}
+	req, err := u.client.newRequest(context.WithoutCancel(u.ctx), http.MethodDelete, u.bucket, u.key,
+		url.Values{"uploadId": {u.uploadID}}, nil, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.do(req, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putObject sends a whole object that fits in one part
+func (u *Upload) putObject() error {
+	_, err := u.send(http.MethodPut, nil, u.buffer.Bytes())
+	return err
+}
+
+// sendPart sends the buffer as the next part, starting the multipart upload first if needed
+func (u *Upload) sendPart() error {
+	if u.uploadID == "" {
+		if err := u.start(); err != nil {
+			return err
+		}
+	}
+	number := len(u.parts) + 1
+	resp, err := u.send(http.MethodPut, url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {u.uploadID},
+	}, u.buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	u.parts = append(u.parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	u.buffer.Reset()
+	return nil
+}
+
+// start begins a multipart upload
+func (u *Upload) start() error {
+	resp, err := u.send(http.MethodPost, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp.body, &result); err != nil || result.UploadID == "" {
+		return errors.New("S3 store did not return an upload ID")
+	}
+	u.uploadID = result.UploadID
+	return nil
+}
+
+// complete assembles the parts sent into the object
+func (u *Upload) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: u.parts})
+	if err != nil {
+		return err
+	}
+	resp, err := u.send(http.MethodPost, url.Values{"uploadId": {u.uploadID}}, body)
+	if err != nil {
+		return err
+	}
+	// S3 can report a failed completion in the body of a 200 answer
+	apiErr := &APIError{StatusCode: http.StatusOK}
+	if xml.Unmarshal(resp.body, apiErr) == nil && apiErr.Code != "" {
+		return apiErr
+	}
+	return nil
+}
+
+// uploadResponse is an answer whose body has been read
+type uploadResponse struct {
+	Header http.Header
+	body   []byte
+}
+
+// send makes a request with a body held in memory, signing its hash
+func (u *Upload) send(method string, query url.Values, body []byte) (*uploadResponse, error) {
+	sum := sha256.Sum256(body)
+	req, err := u.client.newRequest(u.ctx, method, u.bucket, u.key, query, bytes.NewReader(body), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return &uploadResponse{Header: resp.Header, body: data}, nil
+}
@@ -0,0 +1,74 @@
+// Package seal encrypts short secrets, such as the callback secrets of jobs,
+// so they can be stored without being readable from the database
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix marks a sealed value, and the scheme it was sealed with
+const prefix = "seal1:"
+
+// ErrInvalid is returned for a sealed value that can't be opened with the key
+var ErrInvalid = errors.New("sealed value can't be opened with this key")
+
+// Box seals and opens values with AES-256-GCM
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a box whose AES key is the SHA-256 of key, which should be a
+// long random string
+func New(key string) (*Box, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// IsSealed reports whether a value was sealed by a Box
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Seal encrypts a value under a random nonce, so sealing the same value twice
+// gives different results
+func (b *Box) Seal(value string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(value), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed value, returning ErrInvalid when it wasn't sealed
+// with this box's key or has been altered
+func (b *Box) Open(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", ErrInvalid
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", ErrInvalid
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	opened, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	return string(opened), nil
+}
@@ -0,0 +1,38 @@
+package seal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBoxSealsAndOpens(t *testing.T) {
+	box, err := New("a long random key")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	sealed, err := box.Seal("my-secret")
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "my-secret") {
+		t.Errorf("Expected a sealed value that doesn't show the secret, got %q", sealed)
+	}
+	if again, _ := box.Seal("my-secret"); again == sealed {
+		t.Error("Expected every seal to use a fresh nonce")
+	}
+	if opened, err := box.Open(sealed); err != nil || opened != "my-secret" {
+		t.Errorf("Expected to open my-secret, got %q, %v", opened, err)
+	}
+
+	other, _ := New("another key")
+	if _, err := other.Open(sealed); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid with another key, got %v", err)
+	}
+	for _, value := range []string{"my-secret", prefix + "not base64", prefix + "AAAA", sealed[:len(sealed)-4] + "AAAA"} {
+		if _, err := box.Open(value); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected ErrInvalid for %q, got %v", value, err)
+		}
+	}
+}
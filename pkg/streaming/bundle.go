@@ -0,0 +1,155 @@
+package streaming
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// ExtractBundle unpacks a zip or tar bundle into dir. Each file in the
+// archive is named after the resource it holds, with the format as its
+// extension, e.g. users.csv or comments.ndjson.gz. A tar may itself be
+// compressed with gzip or zstd.
+func (p *Processor) ExtractBundle(archivePath, format, dir string) ([]models.BundleFile, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	var files []models.BundleFile
+	extract := func(name string, content io.Reader) error {
+		bundleFile, ok, err := bundleMember(name)
+		if err != nil || !ok {
+			return err
+		}
+		for _, existing := range files {
+			if existing.ResourceType == bundleFile.ResourceType {
+				return fmt.Errorf("bundle contains more than one %s file", bundleFile.ResourceType)
+			}
+		}
+
+		// Directories in the archive are dropped, so nothing is written outside dir
+		bundleFile.Path = filepath.Join(dir, path.Base(name))
+		if err := p.writeBundleFile(bundleFile.Path, content); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+		files = append(files, bundleFile)
+		return nil
+	}
+
+	switch format {
+	case "zip":
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat bundle: %w", err)
+		}
+		archive, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip bundle: %w", err)
+		}
+		for _, entry := range archive.File {
+			if entry.FileInfo().IsDir() {
+				continue
+			}
+			content, err := entry.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+			}
+			err = extract(entry.Name, content)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case "tar":
+		var reader io.Reader = file
+		switch detectCompression(file, archivePath) {
+		case "gzip":
+			gzipReader, err := gzip.NewReader(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read gzip bundle: %w", err)
+			}
+			defer gzipReader.Close()
+			reader = gzipReader
+		case "zstd":
+			decoder, err := zstd.NewReader(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read zstd bundle: %w", err)
+			}
+			defer decoder.Close()
+			reader = decoder
+		}
+
+		archive := tar.NewReader(reader)
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tar bundle: %w", err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := extract(header.Name, archive); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bundle format: %s", format)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("bundle contains no users, articles or comments file")
+	}
+	return files, nil
+}
+
+// bundleMember works out the resource type and format of a file in a bundle
+// from its name. Hidden files, such as those macOS adds to zip archives, are
+// skipped; any other file that isn't an importable resource is an error.
+func bundleMember(name string) (models.BundleFile, bool, error) {
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".") || strings.Contains(name, "__MACOSX/") {
+		return models.BundleFile{}, false, nil
+	}
+
+	// users.csv.gz -> users, csv; a compressed file is decompressed when imported
+	parts := strings.Split(base, ".")
+	if len(parts) < 2 || !SupportsImport(parts[0], parts[1]) || parts[0] == "bundle" {
+		return models.BundleFile{}, false, fmt.Errorf("unrecognised file %s in bundle; expected e.g. users.csv, articles.ndjson or comments.json", name)
+	}
+	return models.BundleFile{ResourceType: parts[0], Format: parts[1]}, true, nil
+}
+
+// writeBundleFile writes one extracted file, up to the decompressed size limit
+func (p *Processor) writeBundleFile(filePath string, content io.Reader) error {
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(dst, io.LimitReader(content, p.maxDecompressedSize+1))
+	if err == nil && written > p.maxDecompressedSize {
+		err = ErrDecompressedTooLarge
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package streaming
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// DefaultMaxDecompressedSize caps how much data a compressed import file may
+// expand to, so a small upload can't unpack into an unbounded stream
+const DefaultMaxDecompressedSize int64 = 1 << 30 // 1GB
+
+// ErrDecompressedTooLarge is returned when a compressed import file expands past the limit
+var ErrDecompressedTooLarge = errors.New("decompressed import file exceeds the size limit")
+
+// importInput is the content of an import file, decompressed when the file is
+// compressed. Offsets into the content are what checkpoints record.
+type importInput struct {
+	io.ReadSeeker
+	size        int64        // bytes in the file itself
+	compression string       // gzip, zstd, zip, or "" for a plain file
+	position    func() int64 // bytes read from the file so far; nil when the content is the file
+	streams     []*decompressedStream
+}
+
+// openImportInput detects whether file is compressed, by its magic bytes or
+// else its name, and returns its content decoded as the options ask
+func openImportInput(file importFile, size int64, name string, maxSize int64, options models.ImportOptions) (*importInput, error) {
+	counter := &countingFile{file: file}
+	input := &importInput{ReadSeeker: file, size: size}
+	if input.compression = detectCompression(file, name); input.compression != "" {
+		if err := input.decompress(counter, maxSize); err != nil {
+			return nil, err
+		}
+	}
+	if err := input.decodeText(options, counter, maxSize); err != nil {
+		input.Close()
+		return nil, err
+	}
+	return input, nil
+}
+
+// decompress replaces the content of a compressed file with its decompressed stream
+func (in *importInput) decompress(counter *countingFile, maxSize int64) error {
+	stream := &decompressedStream{maxSize: maxSize}
+
+	switch in.compression {
+	case "gzip":
+		stream.open = func() (io.Reader, io.Closer, error) {
+			if err := counter.rewind(); err != nil {
+				return nil, nil, err
+			}
+			reader, err := gzip.NewReader(counter)
+			return reader, reader, err
+		}
+	case "zstd":
+		stream.open = func() (io.Reader, io.Closer, error) {
+			if err := counter.rewind(); err != nil {
+				return nil, nil, err
+			}
+			decoder, err := zstd.NewReader(counter)
+			if err != nil {
+				return nil, nil, err
+			}
+			return decoder, decoder.IOReadCloser(), nil
+		}
+	case "zip":
+		archive, err := zip.NewReader(counter, in.size)
+		if err != nil {
+			return fmt.Errorf("failed to read zip archive: %w", err)
+		}
+		entry, err := singleZipEntry(archive)
+		if err != nil {
+			return err
+		}
+		stream.open = func() (io.Reader, io.Closer, error) {
+			counter.read = 0
+			reader, err := entry.Open()
+			return reader, reader, err
+		}
+	}
+
+	if err := stream.reopen(); err != nil {
+		return fmt.Errorf("failed to open %s stream: %w", in.compression, err)
+	}
+	in.ReadSeeker = stream
+	in.position = func() int64 { return counter.read }
+	in.streams = append(in.streams, stream)
+	return nil
+}
+
+// Err returns ErrDecompressedTooLarge once the content has passed the size
+// limit. Decoders may stop quietly on a read error, so the import loop checks
+// this after reading the last record.
+func (in *importInput) Err() error {
+	for _, stream := range in.streams {
+		if stream.limitErr != nil {
+			return stream.limitErr
+		}
+	}
+	return nil
+}
+
+// Close releases the decompressor and transcoder, if any
+func (in *importInput) Close() {
+	for _, stream := range in.streams {
+		if stream.closer != nil {
+			stream.closer.Close()
+		}
+	}
+}
+
+// detectCompression returns the compression of a file from its magic bytes,
+// falling back to its extension
+func detectCompression(file io.ReaderAt, name string) string {
+	magic := make([]byte, 4)
+	n, _ := file.ReadAt(magic, 0)
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return "zip"
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz", ".gzip":
+		return "gzip"
+	case ".zst", ".zstd":
+		return "zstd"
+	case ".zip":
+		return "zip"
+	}
+	return ""
+}
+
+// singleZipEntry returns the one file in a zip archive
+func singleZipEntry(archive *zip.Reader) (*zip.File, error) {
+	var entry *zip.File
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if entry != nil {
+			return nil, fmt.Errorf("zip archive must contain a single file, found %s and %s", entry.Name, f.Name)
+		}
+		entry = f
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("zip archive contains no file")
+	}
+	return entry, nil
+}
+
+// decompressedStream reads decompressed or transcoded content up to a size
+// limit. It can only read forward, so seeking back to a checkpoint decodes
+// again from the start.
+type decompressedStream struct {
+	open     func() (io.Reader, io.Closer, error)
+	reader   io.Reader
+	closer   io.Closer
+	pos      int64 // bytes of content read so far
+	maxSize  int64
+	limitErr error
+}
+
+// reopen starts decompressing from the beginning of the file
+func (s *decompressedStream) reopen() error {
+	if s.closer != nil {
+		s.closer.Close()
+	}
+	reader, closer, err := s.open()
+	if err != nil {
+		return err
+	}
+	s.reader, s.closer, s.pos = reader, closer, 0
+	return nil
+}
+
+func (s *decompressedStream) Read(p []byte) (int, error) {
+	if s.limitErr != nil {
+		return 0, s.limitErr
+	}
+
+	// Read one byte past the limit to tell a file that ends exactly there from one that goes on
+	if remaining := s.maxSize - s.pos + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := s.reader.Read(p)
+	s.pos += int64(n)
+	if s.pos > s.maxSize {
+		s.limitErr = ErrDecompressedTooLarge
+		return n - int(s.pos-s.maxSize), s.limitErr
+	}
+	return n, err
+}
+
+// Seek moves to an absolute content offset, which is all checkpoints need
+func (s *decompressedStream) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return s.pos, fmt.Errorf("compressed input only supports seeking from the start")
+	}
+	if offset < s.pos {
+		if err := s.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, s, offset-s.pos); err != nil {
+		return s.pos, err
+	}
+	return s.pos, nil
+}
+
+// countingFile counts the bytes read from a file, to report import progress
+// through a compressed file
+type countingFile struct {
+	file importFile
+	read int64
+}
+
+func (c *countingFile) Read(p []byte) (int, error) {
+	n, err := c.file.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+func (c *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.file.ReadAt(p, off)
+	c.read += int64(n)
+	return n, err
+}
+
+// rewind moves back to the start of the file for another pass
+func (c *countingFile) rewind() error {
+	c.read = 0
+	_, err := c.file.Seek(0, io.SeekStart)
+	return err
+}
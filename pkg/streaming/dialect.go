@@ -0,0 +1,173 @@
+package streaming
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// utf8BOM is the byte order mark some tools, notably Excel, put at the start of UTF-8 files
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// ValidateImportOptions checks the CSV dialect and character set of an import,
+// so a job is never created with options the reader would reject
+func ValidateImportOptions(options models.ImportOptions) error {
+	delimiter := ','
+	if options.Delimiter != "" {
+		r, err := dialectRune("delimiter", options.Delimiter)
+		if err != nil {
+			return err
+		}
+		delimiter = r
+	}
+	if options.Comment != "" {
+		comment, err := dialectRune("comment", options.Comment)
+		if err != nil {
+			return err
+		}
+		if comment == delimiter {
+			return fmt.Errorf("comment must differ from the delimiter")
+		}
+	}
+	_, err := textEncoding(options.Charset)
+	return err
+}
+
+// dialectRune returns the single character of a CSV dialect option
+func dialectRune(name, value string) (rune, error) {
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("%s must be a single character other than a quote or line break", name)
+	}
+	return r, nil
+}
+
+// textEncoding looks up a character set by its WHATWG label, such as latin1,
+// windows-1252, shift_jis or utf-16le. UTF-8 needs no transcoding and gives nil.
+func textEncoding(charset string) (encoding.Encoding, error) {
+	if charset == "" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// newCSVReader returns a reader for the CSV dialect of an import
+func newCSVReader(r io.Reader, options models.ImportOptions) *csv.Reader {
+	reader := csv.NewReader(r)
+	if options.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(options.Delimiter)
+	}
+	if options.Comment != "" {
+		reader.Comment, _ = utf8.DecodeRuneInString(options.Comment)
+	}
+	reader.LazyQuotes = options.LazyQuotes
+	return reader
+}
+
+// decodeText transcodes the content of an import to UTF-8 and strips a leading
+// byte order mark, unless the options keep it. A UTF-16 byte order mark is
+// honoured even when no charset was given. Like decompressed content,
+// transcoded content can only be read forward and is limited to maxSize.
+func (in *importInput) decodeText(options models.ImportOptions, counter *countingFile, maxSize int64) error {
+	enc, err := textEncoding(options.Charset)
+	if err != nil {
+		return err
+	}
+
+	var decoder func() transform.Transformer
+	switch {
+	case enc != nil && options.KeepBOM:
+		decoder = func() transform.Transformer { return enc.NewDecoder() }
+	case enc != nil:
+		decoder = func() transform.Transformer { return unicode.BOMOverride(enc.NewDecoder()) }
+	case !options.KeepBOM:
+		bom, err := in.peek(len(utf8BOM))
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if bytes.HasPrefix(bom, utf8BOM) {
+			// UTF-8 needs no decoding, so the content stays seekable
+			skipped := &skipReadSeeker{ReadSeeker: in.ReadSeeker, skip: int64(len(utf8BOM))}
+			if _, err := skipped.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to skip byte order mark: %w", err)
+			}
+			in.ReadSeeker = skipped
+			return nil
+		}
+		if bytes.HasPrefix(bom, []byte{0xfe, 0xff}) || bytes.HasPrefix(bom, []byte{0xff, 0xfe}) {
+			decoder = func() transform.Transformer { return unicode.BOMOverride(transform.Nop) }
+		}
+	}
+	if decoder == nil {
+		return nil
+	}
+
+	// Progress counts bytes of the file; a compressed file is counted already
+	content := in.ReadSeeker
+	var source io.Reader = content
+	rewind := func() error {
+		_, err := content.Seek(0, io.SeekStart)
+		return err
+	}
+	if in.position == nil {
+		source, rewind = counter, counter.rewind
+		in.position = func() int64 { return counter.read }
+	}
+
+	stream := &decompressedStream{maxSize: maxSize}
+	stream.open = func() (io.Reader, io.Closer, error) {
+		if err := rewind(); err != nil {
+			return nil, nil, err
+		}
+		return transform.NewReader(source, decoder()), nil, nil
+	}
+	if err := stream.reopen(); err != nil {
+		return fmt.Errorf("failed to transcode file: %w", err)
+	}
+	in.ReadSeeker = stream
+	in.streams = append(in.streams, stream)
+	return nil
+}
+
+// peek returns up to n bytes from the start of the content and rewinds it
+func (in *importInput) peek(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(in.ReadSeeker, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if _, err := in.ReadSeeker.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// skipReadSeeker hides the first bytes of its content, so that offsets, and
+// with them checkpoints, don't count a stripped byte order mark
+type skipReadSeeker struct {
+	io.ReadSeeker
+	skip int64
+}
+
+func (s *skipReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return 0, fmt.Errorf("import content only supports seeking from the start")
+	}
+	pos, err := s.ReadSeeker.Seek(offset+s.skip, io.SeekStart)
+	return pos - s.skip, err
+}
@@ -0,0 +1,30 @@
+package streaming
+
+import "slices"
+
+// importFormats lists the formats each resource type can be imported from.
+// The API checks it before creating a job and ProcessImport dispatches on it,
+// so a job is never accepted for a combination the processor would reject.
+var importFormats = map[string][]string{
+	"users":    {"csv", "ndjson", "json"},
+	"articles": {"csv", "ndjson", "json"},
+	"comments": {"csv", "ndjson", "json"},
+	"bundle":   {"zip", "tar"}, // an archive of the files above, see ExtractBundle
+}
+
+// exportFormats lists the formats each resource type can be exported to
+var exportFormats = map[string][]string{
+	"users":    {"csv", "ndjson", "json"},
+	"articles": {"ndjson", "json"},
+	"comments": {"ndjson", "json"},
+}
+
+// SupportsImport reports whether resourceType can be imported from format
+func SupportsImport(resourceType, format string) bool {
+	return slices.Contains(importFormats[resourceType], format)
+}
+
+// SupportsExport reports whether resourceType can be exported to format
+func SupportsExport(resourceType, format string) bool {
+	return slices.Contains(exportFormats[resourceType], format)
+}
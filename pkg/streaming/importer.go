@@ -0,0 +1,441 @@
+package streaming
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/internal/validation"
+)
+
+// recordSource reads the records of an import file one at a time
+type recordSource[T any] interface {
+	// next returns the next record, or a row error for a record that could
+	// not be parsed. It returns io.EOF after the last record.
+	next() (T, *models.ValidationError, error)
+	// offset returns the bytes consumed since the source started reading
+	offset() int64
+}
+
+// resourceImporter holds what the import loop needs to know about one resource type
+type resourceImporter[T any] struct {
+	name     string   // singular, for error messages
+	columns  []string // CSV columns in export order, for files without a header
+	parseCSV func(record []string, colIndex map[string]int) (T, error)
+	validate func(validator *validation.BatchValidator, batch []T, startRow int) []T
+	insert   func(batch []T) error
+}
+
+// importRecords reads a job's file in its format, validating and writing its
+// records in batches. A checkpoint is saved after every batch, and a job with
+// a checkpoint continues from its byte offset.
+func importRecords[T any](ctx context.Context, p *Processor, job *models.ImportJob, input *importInput, start models.ImportCheckpoint, importer resourceImporter[T]) error {
+	jobID := job.ID
+	mapping := newFieldMapping(job.ResourceType, job.Options.Mapping, func(columns []string) {
+		p.jobManager.AddImportWarnings(jobID, unmappedWarnings(columns)...)
+	})
+	transform, err := newFieldTransformer(job.ResourceType, job.Options.Transforms)
+	if err != nil {
+		return err
+	}
+
+	source, err := newRecordSource(input, job.Format, job.Options, start, importer, mapping, transform)
+	if err != nil {
+		return err
+	}
+
+	// Progress is measured through the file itself, which for a compressed
+	// file is not where the checkpoint offset points
+	filePosition := func() int64 { return start.ByteOffset + source.offset() }
+	if input.position != nil {
+		filePosition = input.position
+	}
+	tracker := newImportTracker(input.size, models.ImportCheckpoint{
+		ByteOffset: filePosition(),
+		RowNumber:  start.RowNumber,
+	})
+
+	validator := validation.NewBatchValidator(p.storage)
+	totalProcessed := start.RowNumber
+	totalValid := start.ValidRecords
+	batch := make([]T, 0, BatchSize)
+	progress := tracker.progress(filePosition())
+
+	// flush validates and writes the batch, then reports its errors and checkpoint
+	flush := func() error {
+		valid := importer.validate(validator, batch, totalProcessed-len(batch))
+		if len(valid) > 0 {
+			if err := importer.insert(valid); err != nil {
+				return fmt.Errorf("failed to insert %s batch: %w", importer.name, err)
+			}
+			totalValid += len(valid)
+			p.jobManager.RecordCommittedBatch(jobID)
+		}
+
+		offset := start.ByteOffset + source.offset()
+		progress = tracker.progress(filePosition())
+		p.reportProgress(jobID, tracker, filePosition(), totalProcessed)
+		p.jobManager.UpdateImportJob(jobID, "processing", progress, totalProcessed, totalValid,
+			0, validator.GetErrors()) // errorRecords will be calculated by job manager
+		p.jobManager.RecordTransformCounts(jobID, transform.takeCounts())
+		p.jobManager.SaveImportCheckpoint(jobID, models.ImportCheckpoint{
+			ByteOffset:   offset,
+			RowNumber:    totalProcessed,
+			ValidRecords: totalValid,
+		})
+
+		// Clear batch and validator for next iteration
+		batch = make([]T, 0, BatchSize)
+		validator = validation.NewBatchValidator(p.storage)
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		record, rowErr, err := source.next()
+		if err == io.EOF {
+			break
+		}
+		if inputErr := input.Err(); inputErr != nil {
+			return inputErr
+		}
+		if err != nil {
+			return err
+		}
+
+		if rowErr != nil {
+			// Report records that could not be parsed immediately
+			p.jobManager.UpdateImportJob(jobID, "processing", progress, totalProcessed, totalValid, 0, []models.ValidationError{*rowErr})
+		} else {
+			batch = append(batch, record)
+		}
+		totalProcessed++
+
+		if len(batch) >= BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := input.Err(); err != nil {
+		return err
+	}
+
+	// Process remaining batch
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	// Rows after the last batch that could not be parsed may still have been transformed
+	p.jobManager.RecordTransformCounts(jobID, transform.takeCounts())
+
+	// Mark job as completed - no need to pass errors since job manager tracks them
+	p.reportProgress(jobID, tracker, tracker.fileSize, totalProcessed)
+	p.jobManager.UpdateImportJob(jobID, "completed", 100, totalProcessed, totalValid, 0, nil)
+
+	return nil
+}
+
+// newRecordSource opens the records of an import's content in its format
+func newRecordSource[T any](input *importInput, format string, options models.ImportOptions, start models.ImportCheckpoint, importer resourceImporter[T], mapping *fieldMapping, transform *fieldTransformer) (recordSource[T], error) {
+	switch format {
+	case "csv":
+		return newCSVSource(input, start, options, importer.columns, mapping, transform, importer.parseCSV)
+	case "ndjson":
+		return newNDJSONSource[T](input, start, mapping, transform)
+	case "json":
+		return newJSONArraySource[T](input, start, mapping, transform)
+	default:
+		return nil, fmt.Errorf("unsupported format for %ss: %s", importer.name, format)
+	}
+}
+
+// csvSource reads records from a CSV file, with a header row unless the
+// options say otherwise
+type csvSource[T any] struct {
+	reader    *csv.Reader
+	colIndex  map[string]int
+	transform *fieldTransformer // nil unless values are transformed
+	parse     func(record []string, colIndex map[string]int) (T, error)
+	line      int // line of the last record read, counting the header
+}
+
+// newCSVSource reads the header of a CSV file, renaming its columns when
+// there is a mapping, and positions it at the checkpoint. A file without a
+// header has the given columns.
+func newCSVSource[T any](file io.ReadSeeker, start models.ImportCheckpoint, options models.ImportOptions, columns []string, mapping *fieldMapping, transform *fieldTransformer, parse func([]string, map[string]int) (T, error)) (*csvSource[T], error) {
+	reader := newCSVReader(file, options)
+
+	header := columns
+	headerLines := 0
+	if !options.NoHeader {
+		var err error
+		if header, err = reader.Read(); err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		headerLines = 1
+	}
+	if mapping != nil {
+		header = mapping.header(header)
+		filled := append(slices.Clone(header), transform.defaultFields()...)
+		if missing := mapping.missing(filled); len(missing) > 0 {
+			return nil, fmt.Errorf("required fields are not mapped: %s", strings.Join(missing, ", "))
+		}
+	}
+
+	// Find column indices
+	colIndex := make(map[string]int)
+	for i, col := range header {
+		if col != "" { // an unmapped column
+			colIndex[col] = i
+		}
+	}
+	if transform != nil {
+		transform.addDefaultColumns(colIndex, len(header))
+	}
+
+	// When resuming, skip the rows committed before the checkpoint
+	if start.ByteOffset > 0 {
+		if err := seekToCheckpoint(file, start); err != nil {
+			return nil, err
+		}
+		reader = newCSVReader(file, options)
+	}
+
+	return &csvSource[T]{
+		reader:    reader,
+		colIndex:  colIndex,
+		transform: transform,
+		parse:     parse,
+		line:      start.RowNumber + headerLines,
+	}, nil
+}
+
+func (s *csvSource[T]) next() (T, *models.ValidationError, error) {
+	var record T
+
+	fields, err := s.reader.Read()
+	if err == io.EOF {
+		return record, nil, io.EOF
+	}
+	s.line++
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return record, &models.ValidationError{
+			Row:     s.line,
+			Field:   "csv",
+			Message: fmt.Sprintf("CSV parsing error: %v", err),
+		}, nil
+	}
+	if err != nil {
+		return record, nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	if s.transform != nil {
+		fields = s.transform.csvRecord(fields, s.colIndex)
+	}
+	record, err = s.parse(fields, s.colIndex)
+	if err != nil {
+		return record, &models.ValidationError{
+			Row:     s.line,
+			Field:   "parsing",
+			Message: err.Error(),
+		}, nil
+	}
+	return record, nil, nil
+}
+
+func (s *csvSource[T]) offset() int64 {
+	return s.reader.InputOffset()
+}
+
+// ndjsonSource reads records from a file with one JSON object per line
+type ndjsonSource[T any] struct {
+	decoder   *json.Decoder
+	input     *readErrorReader
+	mapping   *fieldMapping     // nil unless the fields are renamed
+	transform *fieldTransformer // nil unless values are transformed
+	row       int               // number of the last record read
+	done      bool              // set once the file can't be read any further
+}
+
+// newNDJSONSource positions an NDJSON file at the checkpoint
+func newNDJSONSource[T any](file io.ReadSeeker, start models.ImportCheckpoint, mapping *fieldMapping, transform *fieldTransformer) (*ndjsonSource[T], error) {
+	if err := seekToCheckpoint(file, start); err != nil {
+		return nil, err
+	}
+	input := &readErrorReader{reader: file}
+	return &ndjsonSource[T]{
+		decoder:   json.NewDecoder(input),
+		input:     input,
+		mapping:   mapping,
+		transform: transform,
+		row:       start.RowNumber,
+	}, nil
+}
+
+func (s *ndjsonSource[T]) next() (T, *models.ValidationError, error) {
+	var record T
+	if s.done || !s.decoder.More() {
+		return record, nil, io.EOF
+	}
+	s.row++
+
+	record, err := decodeRecord[T](s.decoder, s.mapping, s.transform)
+	if err != nil {
+		if s.input.err != nil {
+			return record, nil, s.input.err
+		}
+		// The decoder can skip a record of the wrong type, but not malformed JSON
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			s.done = true
+		}
+		return record, &models.ValidationError{
+			Row:     s.row,
+			Field:   "json",
+			Message: fmt.Sprintf("JSON parsing error: %v", err),
+		}, nil
+	}
+	return record, nil, nil
+}
+
+func (s *ndjsonSource[T]) offset() int64 {
+	return s.decoder.InputOffset()
+}
+
+// readErrorReader remembers why a read failed, which a json.Decoder reports
+// as if the record being decoded were malformed
+type readErrorReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *readErrorReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// jsonArraySource reads records from a file holding one JSON array of
+// objects, decoding one element at a time so memory stays flat
+type jsonArraySource[T any] struct {
+	decoder   *json.Decoder
+	mapping   *fieldMapping     // nil unless the fields are renamed
+	transform *fieldTransformer // nil unless values are transformed
+	base      int64             // adjusts the decoder's offset to bytes consumed from the file
+	row       int               // index of the last element read, counting from 1
+	done      bool              // set once the array ended or can't be read any further
+}
+
+// newJSONArraySource opens the array of a JSON file, or reopens it at the checkpoint
+func newJSONArraySource[T any](file io.ReadSeeker, start models.ImportCheckpoint, mapping *fieldMapping, transform *fieldTransformer) (*jsonArraySource[T], error) {
+	if err := seekToCheckpoint(file, start); err != nil {
+		return nil, err
+	}
+
+	source := &jsonArraySource[T]{mapping: mapping, transform: transform, row: start.RowNumber}
+	if start.ByteOffset > 0 {
+		// A checkpoint sits just after an element, so skip the separator that
+		// follows it and decode the rest as if it were a new array
+		reader := bufio.NewReader(file)
+		skipped, err := skipArraySeparator(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume JSON array: %w", err)
+		}
+		source.decoder = json.NewDecoder(io.MultiReader(strings.NewReader("["), reader))
+		source.base = skipped - 1 // the "[" above is not part of the file
+	} else {
+		source.decoder = json.NewDecoder(file)
+	}
+
+	token, err := source.decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON array: %w", err)
+	}
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("JSON import must be an array of objects")
+	}
+	return source, nil
+}
+
+// skipArraySeparator consumes whitespace and the comma between two array
+// elements, returning the number of bytes consumed. A closing bracket is left
+// in place.
+func skipArraySeparator(reader *bufio.Reader) (int64, error) {
+	var skipped int64
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return skipped, err
+		}
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			skipped++
+		case ',':
+			return skipped + 1, nil
+		case ']':
+			return skipped, reader.UnreadByte()
+		default:
+			return skipped, fmt.Errorf("unexpected %q after array element", b)
+		}
+	}
+}
+
+func (s *jsonArraySource[T]) next() (T, *models.ValidationError, error) {
+	var record T
+	if s.done {
+		return record, nil, io.EOF
+	}
+
+	if !s.decoder.More() {
+		s.done = true
+		if _, err := s.decoder.Token(); err != nil {
+			// The file ended before the closing bracket
+			return record, &models.ValidationError{
+				Row:     s.row + 1,
+				Field:   "json",
+				Message: "JSON parsing error: array is not closed",
+			}, nil
+		}
+		return record, nil, io.EOF
+	}
+	s.row++
+
+	record, err := decodeRecord[T](s.decoder, s.mapping, s.transform)
+	if err != nil {
+		// The decoder can skip an element of the wrong type, but not malformed JSON
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			s.done = true
+		}
+		return record, &models.ValidationError{
+			Row:     s.row,
+			Field:   "json",
+			Message: fmt.Sprintf("JSON parsing error: %v", err),
+		}, nil
+	}
+	return record, nil, nil
+}
+
+func (s *jsonArraySource[T]) offset() int64 {
+	return s.base + s.decoder.InputOffset()
+}
@@ -0,0 +1,288 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// resourceFields are the fields of each resource a source column can be mapped to
+var resourceFields = map[string][]string{
+	"users":    userColumns,
+	"articles": articleColumns,
+	"comments": commentColumns,
+}
+
+// requiredFields are the fields validation rejects a record without
+var requiredFields = map[string][]string{
+	"users":    {"email", "name", "role"},
+	"articles": {"slug", "title", "body", "author_id", "status"},
+	"comments": {"article_id", "user_id", "body"},
+}
+
+// ValidateMapping checks that a column mapping only fills fields of the
+// resource, and each field from one source at most
+func ValidateMapping(resourceType, format string, mapping map[string]string, noHeader bool) error {
+	if len(mapping) == 0 {
+		return nil
+	}
+	fields, ok := resourceFields[resourceType]
+	if !ok {
+		return fmt.Errorf("column mapping is not supported for %s imports", resourceType)
+	}
+	if format == "csv" && noHeader {
+		return fmt.Errorf("column mapping needs a CSV header row")
+	}
+
+	filledBy := make(map[string]string)
+	for _, source := range slices.Sorted(maps.Keys(mapping)) {
+		field := mapping[source]
+		if source == "" {
+			return fmt.Errorf("column mapping has an empty source column")
+		}
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("cannot map %q to %q, which is not a %s field", source, field, resourceType)
+		}
+		if other, exists := filledBy[field]; exists {
+			return fmt.Errorf("both %q and %q are mapped to %s", other, source, field)
+		}
+		filledBy[field] = source
+	}
+	return nil
+}
+
+// CheckMapping reads the header of an import file, or the first record of a
+// JSON file, and checks that the column mapping fills every required field.
+// It returns warnings for the source columns that fill no field, which the
+// import will ignore. ctx bounds the reads of a file in an object store.
+func (p *Processor) CheckMapping(ctx context.Context, filePath, resourceType, format string, options models.ImportOptions) ([]string, error) {
+	if len(options.Mapping) == 0 {
+		return nil, nil
+	}
+
+	file, size, err := p.openImportFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	input, err := openImportInput(file, size, filepath.Base(filePath), p.maxDecompressedSize, options)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	var warnings []string
+	mapping := newFieldMapping(resourceType, options.Mapping, func(columns []string) {
+		warnings = append(warnings, unmappedWarnings(columns)...)
+	})
+
+	var filled []string
+	switch format {
+	case "csv":
+		header, err := newCSVReader(input, options).Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		filled = mapping.header(header)
+	case "ndjson", "json":
+		decoder := json.NewDecoder(input)
+		if format == "json" {
+			if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+				return nil, fmt.Errorf("JSON import must be an array of objects")
+			}
+		}
+		if !decoder.More() {
+			return nil, nil // no records to check
+		}
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to read first record: %w", err)
+		}
+		filled = slices.Collect(maps.Keys(mapping.record(record)))
+	}
+
+	// A field with a default transform is filled even without a column
+	transform, err := newFieldTransformer(resourceType, options.Transforms)
+	if err != nil {
+		return nil, err
+	}
+	filled = append(filled, transform.defaultFields()...)
+
+	if missing := mapping.missing(filled); len(missing) > 0 {
+		return warnings, fmt.Errorf("required fields are not mapped: %s", strings.Join(missing, ", "))
+	}
+	return warnings, nil
+}
+
+// unmappedWarnings describes source columns that fill no field
+func unmappedWarnings(columns []string) []string {
+	warnings := make([]string, len(columns))
+	for i, column := range columns {
+		warnings[i] = fmt.Sprintf("Source column %q is not mapped to a field and is ignored", column)
+	}
+	return warnings
+}
+
+// fieldMapping renames the columns of a CSV file, or the paths of JSON
+// records, to the fields of a resource. A column named after a field fills
+// it, unless the mapping fills that field from another column.
+type fieldMapping struct {
+	mapping  map[string]string // source column or JSON path -> field
+	fields   []string          // fields of the resource
+	required []string
+	targets  map[string]bool // fields the mapping fills
+	warn     func(unmapped []string)
+	warned   map[string]bool // unmapped columns reported already
+}
+
+// newFieldMapping returns nil when there is no mapping, so records are read as they are
+func newFieldMapping(resourceType string, mapping map[string]string, warn func(unmapped []string)) *fieldMapping {
+	if len(mapping) == 0 {
+		return nil
+	}
+	m := &fieldMapping{
+		mapping:  mapping,
+		fields:   resourceFields[resourceType],
+		required: requiredFields[resourceType],
+		targets:  make(map[string]bool),
+		warn:     warn,
+		warned:   make(map[string]bool),
+	}
+	for _, field := range mapping {
+		m.targets[field] = true
+	}
+	return m
+}
+
+// target returns the field a source column fills, or "" for none
+func (m *fieldMapping) target(column string) string {
+	if field, ok := m.mapping[column]; ok {
+		return field
+	}
+	if slices.Contains(m.fields, column) && !m.targets[column] {
+		return column
+	}
+	return ""
+}
+
+// header renames the columns of a CSV header to the fields they fill
+func (m *fieldMapping) header(columns []string) []string {
+	renamed := make([]string, len(columns))
+	var unmapped []string
+	for i, column := range columns {
+		if renamed[i] = m.target(column); renamed[i] == "" {
+			unmapped = append(unmapped, column)
+		}
+	}
+	m.report(unmapped)
+	return renamed
+}
+
+// record maps a decoded JSON object to the fields of the resource. A mapped
+// path may reach into nested objects, as in "contact.email".
+func (m *fieldMapping) record(source map[string]any) map[string]any {
+	mapped := make(map[string]any, len(m.fields))
+	used := make(map[string]bool) // top-level keys a mapped path was read from
+	for path, field := range m.mapping {
+		if value, key, ok := lookupPath(source, path); ok {
+			mapped[field] = value
+			used[key] = true
+		}
+	}
+
+	var unmapped []string
+	for key, value := range source {
+		if used[key] {
+			continue
+		}
+		if field := m.target(key); field != "" {
+			mapped[field] = value
+		} else {
+			unmapped = append(unmapped, key)
+		}
+	}
+	m.report(unmapped)
+	return mapped
+}
+
+// missing returns the required fields none of the filled fields cover
+func (m *fieldMapping) missing(filled []string) []string {
+	var missing []string
+	for _, field := range m.required {
+		if !slices.Contains(filled, field) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// report warns about unmapped columns that haven't been reported yet
+func (m *fieldMapping) report(unmapped []string) {
+	var fresh []string
+	for _, column := range unmapped {
+		if !m.warned[column] {
+			m.warned[column] = true
+			fresh = append(fresh, column)
+		}
+	}
+	if len(fresh) > 0 && m.warn != nil {
+		slices.Sort(fresh)
+		m.warn(fresh)
+	}
+}
+
+// lookupPath finds a value by its key, or else by a dotted path through
+// nested objects. It also returns the top-level key the value was read from.
+func lookupPath(source map[string]any, path string) (any, string, bool) {
+	if value, ok := source[path]; ok {
+		return value, path, true
+	}
+
+	parts := strings.Split(path, ".")
+	var value any = source
+	for _, part := range parts {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, "", false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, "", false
+		}
+	}
+	return value, parts[0], true
+}
+
+// decodeRecord decodes the next JSON value into a record, renaming its fields
+// first when there is a mapping and then transforming their values
+func decodeRecord[T any](decoder *json.Decoder, mapping *fieldMapping, transform *fieldTransformer) (T, error) {
+	var record T
+	if mapping == nil && transform == nil {
+		return record, decoder.Decode(&record)
+	}
+
+	var source map[string]any
+	if err := decoder.Decode(&source); err != nil {
+		return record, err
+	}
+	if mapping != nil {
+		source = mapping.record(source)
+	}
+	if transform != nil {
+		if source == nil {
+			source = make(map[string]any)
+		}
+		transform.jsonRecord(source)
+	}
+	encoded, err := json.Marshal(source)
+	if err != nil {
+		return record, err
+	}
+	return record, json.Unmarshal(encoded, &record)
+}
@@ -0,0 +1,136 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vairarchi/bulk-import-export-api/pkg/s3"
+)
+
+// ErrObjectStoreNotConfigured is returned for an s3:// location when no object store is set
+var ErrObjectStoreNotConfigured = errors.New("S3 locations are not configured on this server")
+
+// LocalExportDestination is the destination of an export written to the
+// export directory, even when an export location is set
+const LocalExportDestination = "local"
+
+// importFile is what an import reads: a local file, or an S3 object read in place
+type importFile interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// exportFile is what an export writes: a local file, or an S3 object uploaded as it is written
+type exportFile interface {
+	io.Writer
+	Close() error
+	Abort() error // discards what was written
+}
+
+// SetObjectStore sets the store that s3:// import files are read from and
+// exports are uploaded to
+func (p *Processor) SetObjectStore(client *s3.Client) {
+	p.objects = client
+}
+
+// SetExportLocation uploads exports under an s3://bucket/prefix rather than
+// writing them to the export directory, unless a job asks for another destination
+func (p *Processor) SetExportLocation(location string) {
+	p.exportLocation = strings.TrimSuffix(location, "/")
+}
+
+// CheckExportDestination checks the destination an export job asks for: ""
+// for the server's default, LocalExportDestination, or an s3://bucket/prefix
+// to upload the export under
+func (p *Processor) CheckExportDestination(destination string) error {
+	if destination == "" || destination == LocalExportDestination {
+		return nil
+	}
+	if _, _, err := s3.ParseURL(strings.TrimSuffix(destination, "/") + "/export"); err != nil {
+		return fmt.Errorf("destination must be %q or an s3://bucket/prefix URL", LocalExportDestination)
+	}
+	if p.objects == nil {
+		return ErrObjectStoreNotConfigured
+	}
+	return nil
+}
+
+// CheckImportObject checks that the object at an s3:// URL can be read, so a
+// job isn't created for a file that isn't there. ctx bounds the request to
+// the store.
+func (p *Processor) CheckImportObject(ctx context.Context, location string) error {
+	file, _, err := p.openImportFile(ctx, location)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// openImportFile opens a local import file, or the object at an s3:// URL,
+// and returns its size
+func (p *Processor) openImportFile(ctx context.Context, location string) (importFile, int64, error) {
+	if s3.IsURL(location) {
+		if p.objects == nil {
+			return nil, 0, ErrObjectStoreNotConfigured
+		}
+		object, err := p.objects.Open(ctx, location)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open %s: %w", location, err)
+		}
+		return object, object.Size(), nil
+	}
+
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return file, info.Size(), nil
+}
+
+// createExportFile creates the file an export is written to, at its
+// destination or else the export location, and returns it with the location
+// it is downloaded from
+func (p *Processor) createExportFile(ctx context.Context, fileName, destination string) (exportFile, string, error) {
+	if destination == "" {
+		destination = p.exportLocation
+	}
+	if destination != "" && destination != LocalExportDestination {
+		if p.objects == nil {
+			return nil, "", ErrObjectStoreNotConfigured
+		}
+		location := strings.TrimSuffix(destination, "/") + "/" + fileName
+		upload, err := p.objects.Create(ctx, location)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create export object: %w", err)
+		}
+		return upload, location, nil
+	}
+
+	file, err := os.Create(filepath.Join(p.exportDir, fileName))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create export file: %w", err)
+	}
+	// Return relative path as download URL
+	return localExportFile{file}, fmt.Sprintf("/downloads/%s", fileName), nil
+}
+
+// localExportFile is an export written to the export directory
+type localExportFile struct {
+	*os.File
+}
+
+func (f localExportFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
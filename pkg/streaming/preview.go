@@ -0,0 +1,388 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/internal/validation"
+)
+
+// DefaultPreviewRows is how many records a preview parses unless asked otherwise
+const DefaultPreviewRows = 10
+
+// MaxPreviewRows caps the records a preview parses
+const MaxPreviewRows = 100
+
+// previewSampleSize is how much of a file is read to detect its character set,
+// format and delimiter
+const previewSampleSize = 64 << 10
+
+// delimiterCandidates are the CSV delimiters a preview detects, most likely first
+var delimiterCandidates = []rune{',', ';', '\t', '|'}
+
+// fieldSynonyms are other names files commonly give a field, normalized as by normalizeName
+var fieldSynonyms = map[string][]string{
+	"id":           {"uuid"},
+	"email":        {"mail", "emailaddress"},
+	"name":         {"fullname", "displayname"},
+	"role":         {"userrole", "usertype"},
+	"active":       {"enabled", "isactive", "isenabled"},
+	"created_at":   {"created", "createdon", "createddate", "creationdate"},
+	"updated_at":   {"updated", "updatedon", "modified", "lastmodified"},
+	"slug":         {"permalink", "urlslug"},
+	"title":        {"headline", "subject"},
+	"body":         {"content", "text", "message"},
+	"author_id":    {"author", "userid", "writer"},
+	"tags":         {"tag", "keywords", "categories"},
+	"published_at": {"published", "publishdate", "publishedon"},
+	"status":       {"state"},
+	"article_id":   {"article", "post", "postid"},
+	"user_id":      {"user", "author", "authorid", "commenter"},
+}
+
+// SupportsPreview reports whether files of resourceType can be previewed in
+// format, or in a detected format when format is empty
+func SupportsPreview(resourceType, format string) bool {
+	_, ok := resourceFields[resourceType]
+	return ok && (format == "" || SupportsImport(resourceType, format))
+}
+
+// PreviewImport detects the format, CSV delimiter and character set of an
+// import file where the request doesn't give them, lists its columns and
+// suggests a mapping to the fields of the resource. It then parses and
+// validates up to limit records the way an import would, with the mapping of
+// the options or else the suggested one, but writes nothing. ctx bounds the
+// reads of a file in an object store.
+func (p *Processor) PreviewImport(ctx context.Context, filePath, fileName, resourceType, format string, options models.ImportOptions, limit int) (*models.ImportPreview, error) {
+	if !SupportsPreview(resourceType, format) {
+		return nil, fmt.Errorf("cannot preview %s files as %s", format, resourceType)
+	}
+	if limit <= 0 {
+		limit = DefaultPreviewRows
+	}
+	limit = min(limit, MaxPreviewRows)
+
+	file, size, err := p.openImportFile(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	preview := &models.ImportPreview{ResourceType: resourceType, Format: format, Charset: options.Charset}
+	if options.Charset == "" {
+		if preview.Charset, err = p.detectCharset(file, size, fileName); err != nil {
+			return nil, err
+		}
+		if preview.Charset != "utf-8" {
+			options.Charset = preview.Charset
+		}
+	}
+
+	input, err := openImportInput(file, size, fileName, p.maxDecompressedSize, options)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	preview.Compression = input.compression
+
+	sample, err := input.peek(previewSampleSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if preview.Format == "" {
+		preview.Format = detectFormat(sample)
+	}
+	if preview.Format == "csv" {
+		if options.Delimiter == "" {
+			options.Delimiter = detectDelimiter(sample)
+		}
+		preview.Delimiter = options.Delimiter
+	}
+
+	switch resourceType {
+	case "users":
+		err = previewRecords(p, preview, input, options, limit, resourceImporter[models.User]{
+			name:     "user",
+			columns:  userColumns,
+			parseCSV: parseUserFromCSV,
+			validate: (*validation.BatchValidator).ValidateUsers,
+		})
+	case "articles":
+		err = previewRecords(p, preview, input, options, limit, resourceImporter[models.Article]{
+			name:     "article",
+			columns:  articleColumns,
+			parseCSV: parseArticleFromCSV,
+			validate: (*validation.BatchValidator).ValidateArticles,
+		})
+	case "comments":
+		err = previewRecords(p, preview, input, options, limit, resourceImporter[models.Comment]{
+			name:     "comment",
+			columns:  commentColumns,
+			parseCSV: parseCommentFromCSV,
+			validate: (*validation.BatchValidator).ValidateComments,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// previewRecords lists the columns of a file, suggests a mapping for them, and
+// parses and validates its first records
+func previewRecords[T any](p *Processor, preview *models.ImportPreview, input *importInput, options models.ImportOptions, limit int, importer resourceImporter[T]) error {
+	resourceType := preview.ResourceType
+	columns, err := previewColumns(input, preview.Format, options, importer.columns, limit)
+	if err != nil {
+		return err
+	}
+	preview.Columns = columns
+
+	// A file without a header has the columns of an export, which need no mapping
+	mapping := options.Mapping
+	if !options.NoHeader || preview.Format != "csv" {
+		preview.SuggestedMapping = suggestMapping(resourceType, columns)
+		if len(mapping) == 0 {
+			mapping = preview.SuggestedMapping
+		}
+	}
+	preview.Mapping = mapping
+
+	filled := columns
+	if m := newFieldMapping(resourceType, mapping, func(unmapped []string) {
+		preview.UnmappedColumns = unmapped
+	}); m != nil {
+		filled = m.header(columns)
+	} else {
+		for _, column := range columns {
+			if !slices.Contains(resourceFields[resourceType], column) {
+				preview.UnmappedColumns = append(preview.UnmappedColumns, column)
+			}
+		}
+	}
+	transform, err := newFieldTransformer(resourceType, options.Transforms)
+	if err != nil {
+		return err
+	}
+	filled = append(filled, transform.defaultFields()...)
+	for _, field := range requiredFields[resourceType] {
+		if !slices.Contains(filled, field) {
+			preview.MissingFields = append(preview.MissingFields, field)
+		}
+	}
+
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	rowMapping := newFieldMapping(resourceType, mapping, nil)
+	if rowMapping != nil {
+		rowMapping.required = nil // listed as missing fields rather than failing the preview
+	}
+	source, err := newRecordSource(input, preview.Format, options, models.ImportCheckpoint{}, importer, rowMapping, transform)
+	if err != nil {
+		return err
+	}
+
+	validator := validation.NewBatchValidator(p.storage)
+	preview.Rows = make([]models.PreviewRow, 0, limit)
+	for len(preview.Rows) < limit {
+		record, rowErr, err := source.next()
+		if err == io.EOF {
+			break
+		}
+		if inputErr := input.Err(); inputErr != nil {
+			return inputErr
+		}
+		if err != nil {
+			return err
+		}
+
+		row := models.PreviewRow{Row: len(preview.Rows) + 1}
+		if rowErr != nil {
+			row.Errors = []models.ValidationError{*rowErr}
+		} else {
+			row.Record = record
+			importer.validate(validator, []T{record}, row.Row-1)
+			row.Errors = validator.GetErrors()
+			validator.ClearErrors()
+		}
+		if row.Valid = len(row.Errors) == 0; row.Valid {
+			preview.ValidRows++
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+	return nil
+}
+
+// previewColumns returns the header of a CSV file, or the keys of the first
+// records of a JSON file with the keys of nested objects as dotted paths
+func previewColumns(input *importInput, format string, options models.ImportOptions, columns []string, limit int) ([]string, error) {
+	if format == "csv" {
+		if options.NoHeader {
+			return columns, nil
+		}
+		header, err := newCSVReader(input, options).Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		return header, nil
+	}
+
+	decoder := json.NewDecoder(input)
+	if format == "json" {
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil, fmt.Errorf("JSON import must be an array of objects")
+		}
+	}
+	var keys []string
+	for i := 0; i < limit && decoder.More(); i++ {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			break // reported with the rows
+		}
+		keys = appendKeyPaths(keys, "", record)
+	}
+	return keys, nil
+}
+
+// appendKeyPaths adds the keys of a JSON object that aren't listed yet, in
+// sorted order, naming the keys of nested objects by their dotted paths
+func appendKeyPaths(keys []string, prefix string, object map[string]any) []string {
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		path := prefix + key
+		if nested, ok := object[key].(map[string]any); ok && len(nested) > 0 {
+			keys = appendKeyPaths(keys, path+".", nested)
+		} else if !slices.Contains(keys, path) {
+			keys = append(keys, path)
+		}
+	}
+	return keys
+}
+
+// detectCharset guesses the character set of a file from its byte order mark,
+// or else from whether its start is valid UTF-8. Other text is taken to be
+// windows-1252, the usual encoding of spreadsheet exports.
+func (p *Processor) detectCharset(file importFile, size int64, fileName string) (string, error) {
+	raw, err := openImportInput(file, size, fileName, p.maxDecompressedSize, models.ImportOptions{KeepBOM: true})
+	if err != nil {
+		return "", err
+	}
+	defer raw.Close()
+
+	sample, err := raw.peek(previewSampleSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		return "utf-8", nil
+	case bytes.HasPrefix(sample, []byte{0xff, 0xfe}):
+		return "utf-16le", nil
+	case bytes.HasPrefix(sample, []byte{0xfe, 0xff}):
+		return "utf-16be", nil
+	}
+
+	// A full sample may end partway through a character
+	if len(sample) == previewSampleSize {
+		for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(sample[i]) {
+				if !utf8.FullRune(sample[i:]) {
+					sample = sample[:i]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8", nil
+	}
+	return "windows-1252", nil
+}
+
+// detectFormat tells a JSON array from NDJSON and CSV by the first character of the content
+func detectFormat(sample []byte) string {
+	trimmed := bytes.TrimLeft(sample, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return "json"
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return "ndjson"
+	default:
+		return "csv"
+	}
+}
+
+// detectDelimiter picks the candidate delimiter that occurs most often outside
+// quotes in the first line of a CSV file
+func detectDelimiter(sample []byte) string {
+	line, _, _ := bytes.Cut(sample, []byte("\n"))
+	counts := make(map[rune]int)
+	quoted := false
+	for _, r := range string(line) {
+		if r == '"' {
+			quoted = !quoted
+		} else if !quoted {
+			counts[r]++
+		}
+	}
+
+	best := delimiterCandidates[0]
+	for _, candidate := range delimiterCandidates[1:] {
+		if counts[candidate] > counts[best] {
+			best = candidate
+		}
+	}
+	return string(best)
+}
+
+// suggestMapping matches the columns of a file to the fields of a resource,
+// first by name ignoring case and punctuation, then by common synonyms. A
+// nested JSON key also matches by its last part.
+func suggestMapping(resourceType string, columns []string) map[string]string {
+	matchers := []func(column, field string) bool{
+		func(column, field string) bool {
+			return normalizeName(column) == normalizeName(field)
+		},
+		func(column, field string) bool {
+			name := normalizeName(column[strings.LastIndex(column, ".")+1:])
+			return name == normalizeName(field) || slices.Contains(fieldSynonyms[field], name)
+		},
+	}
+
+	mapping := make(map[string]string)
+	taken := make(map[string]bool) // fields a column was matched to
+	for _, matches := range matchers {
+		for _, column := range columns {
+			if _, matched := mapping[column]; matched {
+				continue
+			}
+			for _, field := range resourceFields[resourceType] {
+				if !taken[field] && matches(column, field) {
+					mapping[column] = field
+					taken[field] = true
+					break
+				}
+			}
+		}
+	}
+	return mapping
+}
+
+// normalizeName lowercases a name and drops everything but letters and digits
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
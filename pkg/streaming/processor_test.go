@@ -0,0 +1,897 @@
+package streaming
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/jobs"
+	"github.com/vairarchi/bulk-import-export-api/pkg/s3"
+	"github.com/vairarchi/bulk-import-export-api/pkg/s3/s3test"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// fakeStorage records inserted rows in memory
+type fakeStorage struct {
+	users    []models.User
+	articles []models.Article
+	comments []models.Comment
+}
+
+func (s *fakeStorage) BatchInsertUsers(users []models.User) error {
+	s.users = append(s.users, users...)
+	return nil
+}
+
+func (s *fakeStorage) BatchInsertArticles(articles []models.Article) error {
+	s.articles = append(s.articles, articles...)
+	return nil
+}
+
+func (s *fakeStorage) BatchInsertComments(comments []models.Comment) error {
+	s.comments = append(s.comments, comments...)
+	return nil
+}
+
+func (s *fakeStorage) GetUsers(filters map[string]string) (*sql.Rows, error)    { return nil, nil }
+func (s *fakeStorage) GetArticles(filters map[string]string) (*sql.Rows, error) { return nil, nil }
+func (s *fakeStorage) GetComments(filters map[string]string) (*sql.Rows, error) { return nil, nil }
+func (s *fakeStorage) UserExists(id string) bool                                { return true }
+func (s *fakeStorage) ArticleExists(id string) bool                             { return true }
+func (s *fakeStorage) CommentExists(id string) bool                             { return false }
+func (s *fakeStorage) EmailExists(email string) bool                            { return false }
+func (s *fakeStorage) SlugExists(slug string) bool                              { return false }
+
+// writeUsersCSV writes a users CSV with the given number of valid rows
+func writeUsersCSV(t *testing.T, rows int) string {
+	t.Helper()
+
+	var b strings.Builder
+	b.WriteString("email,name,role,active\n")
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&b, "user%d@example.com,User %d,reader,true\n", i, i)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return path
+}
+
+func TestProcessImportResumesFromCheckpoint(t *testing.T) {
+	path := writeUsersCSV(t, BatchSize+10)
+
+	// First run records a checkpoint after every flushed batch
+	firstStore := &fakeStorage{}
+	jm := jobs.NewJobManager()
+	job := jm.CreateImportJob("users", "csv", path)
+	processor := NewProcessor(firstStore, jm, t.TempDir())
+
+	if err := processor.ProcessImport(context.Background(), job); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	done, _ := jm.GetImportJob(job.ID)
+	if done.Checkpoint == nil || done.Checkpoint.RowNumber != BatchSize+10 {
+		t.Fatalf("Expected final checkpoint at row %d, got %+v", BatchSize+10, done.Checkpoint)
+	}
+	if done.Checkpoint.ByteOffset != int64(len(readFile(t, path))) {
+		t.Errorf("Expected final checkpoint at end of file, got offset %d", done.Checkpoint.ByteOffset)
+	}
+	if done.Progress != 100 || done.BytesProcessed != done.FileSize || done.ETASeconds != 0 {
+		t.Errorf("Expected the whole file consumed, got progress=%d bytes=%d/%d eta=%d",
+			done.Progress, done.BytesProcessed, done.FileSize, done.ETASeconds)
+	}
+
+	// Resume a second job from the checkpoint taken after the first batch
+	resumeStore := &fakeStorage{}
+	resumed := jm.CreateImportJob("users", "csv", path)
+	processor = NewProcessor(resumeStore, jm, t.TempDir())
+
+	offset := int64(strings.Index(readFile(t, path), fmt.Sprintf("user%d@example.com", BatchSize+1)))
+	resumed.Checkpoint = &models.ImportCheckpoint{ByteOffset: offset, RowNumber: BatchSize, ValidRecords: BatchSize}
+
+	if err := processor.ProcessImport(context.Background(), resumed); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(resumeStore.users) != 10 {
+		t.Fatalf("Expected only the 10 rows after the checkpoint, got %d", len(resumeStore.users))
+	}
+	if resumeStore.users[0].Email != fmt.Sprintf("user%d@example.com", BatchSize+1) {
+		t.Errorf("Expected first resumed row to follow the checkpoint, got %s", resumeStore.users[0].Email)
+	}
+
+	final, _ := jm.GetImportJob(resumed.ID)
+	if final.TotalRecords != BatchSize+10 || final.ValidRecords != BatchSize+10 {
+		t.Errorf("Expected counters to continue from checkpoint, got total=%d valid=%d", final.TotalRecords, final.ValidRecords)
+	}
+}
+
+func TestDryRunImportWritesNothing(t *testing.T) {
+	csvData := "email,name,role,active\n" +
+		"ann@example.com,Ann,admin,true\n" +
+		"bob@example.com,Bob,owner,true\n" + // invalid role
+		"ann@example.com,Ann Again,reader,true\n" // same email as row 1, so an update
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(path, []byte(csvData), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	store := &fakeStorage{}
+	jm := jobs.NewJobManager()
+	job := jm.CreateImportJob("users", "csv", path)
+	jm.SetImportOptions(job.ID, models.ImportOptions{DryRun: true})
+	job, _ = jm.GetImportJob(job.ID)
+
+	if err := NewProcessor(store, jm, t.TempDir()).ProcessImport(context.Background(), job); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(store.users) != 0 {
+		t.Errorf("Expected a dry run to write nothing, got %d users", len(store.users))
+	}
+
+	done, _ := jm.GetImportJob(job.ID)
+	if done.Status != "completed" || done.CommittedBatches != 0 || done.Checkpoint != nil {
+		t.Errorf("Expected a completed dry run without batches or checkpoint, got %+v", done)
+	}
+	expected := models.DryRunResult{ValidRecords: 2, InvalidRecords: 1, WouldCreate: 1, WouldUpdate: 1}
+	if done.DryRunResult == nil || *done.DryRunResult != expected {
+		t.Errorf("Expected dry run result %+v, got %+v", expected, done.DryRunResult)
+	}
+}
+
+func TestImportEveryResourceFormat(t *testing.T) {
+	for resourceType, formats := range importFormats {
+		for _, format := range formats {
+			if !SupportsImport(resourceType, format) {
+				t.Errorf("Expected %s+%s to be importable", resourceType, format)
+			}
+		}
+	}
+	if SupportsImport("articles", "xml") || SupportsImport("widgets", "csv") {
+		t.Error("Expected unknown formats and resources to be rejected")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"users.ndjson": `{"email":"ann@example.com","name":"Ann","role":"admin","active":true}` + "\n",
+		"articles.csv": "slug,title,body,author_id,tags,published_at,status\n" +
+			"hello,Hello,Body,6f1c2a52-4f0e-4a8e-9d6a-2f1f1b2c3d4e, go | api ,2024-01-02T03:04:05Z,published\n" +
+			"draft,Draft,Body,6f1c2a52-4f0e-4a8e-9d6a-2f1f1b2c3d4e,,,draft\n",
+		"comments.csv": "article_id,user_id,body\n" +
+			"6f1c2a52-4f0e-4a8e-9d6a-2f1f1b2c3d4e,7a2d3b63-5f1f-4b9f-8e7b-3a2a2c3d4e5f,Nice\n",
+	}
+
+	store := &fakeStorage{}
+	jm := jobs.NewJobManager()
+	processor := NewProcessor(store, jm, dir)
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		resourceType, format, _ := strings.Cut(name, ".")
+		job := jm.CreateImportJob(resourceType, format, path)
+		if err := processor.ProcessImport(context.Background(), job); err != nil {
+			t.Fatalf("Import of %s failed: %v", name, err)
+		}
+		if done, _ := jm.GetImportJob(job.ID); done.ErrorRecords != 0 {
+			t.Errorf("Expected %s to import cleanly, got %+v", name, done.Errors)
+		}
+	}
+
+	if len(store.users) != 1 || len(store.articles) != 2 || len(store.comments) != 1 {
+		t.Fatalf("Expected 1 user, 2 articles and 1 comment, got %d, %d and %d",
+			len(store.users), len(store.articles), len(store.comments))
+	}
+	for _, article := range store.articles {
+		switch article.Slug {
+		case "hello":
+			if strings.Join(article.Tags, ",") != "go,api" || article.PublishedAt == nil {
+				t.Errorf("Expected tags go,api and a publish date, got %v and %v", article.Tags, article.PublishedAt)
+			}
+		case "draft":
+			if len(article.Tags) != 0 || article.PublishedAt != nil {
+				t.Errorf("Expected no tags and no publish date, got %v and %v", article.Tags, article.PublishedAt)
+			}
+		}
+	}
+}
+
+func TestImportJSONArrayStreamsElements(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("[\n")
+	for i := 1; i <= BatchSize+2; i++ {
+		if i > 1 {
+			b.WriteString(",\n")
+		}
+		if i == 3 {
+			b.WriteString(`"not an object"`)
+			continue
+		}
+		fmt.Fprintf(&b, `  {"email":"user%d@example.com","name":"User %d","role":"reader","active":true}`, i, i)
+	}
+	b.WriteString("\n]\n")
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	store := &fakeStorage{}
+	jm := jobs.NewJobManager()
+	job := jm.CreateImportJob("users", "json", path)
+	if err := NewProcessor(store, jm, t.TempDir()).ProcessImport(context.Background(), job); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	done, _ := jm.GetImportJob(job.ID)
+	if done.TotalRecords != BatchSize+2 || done.ValidRecords != BatchSize+1 || len(store.users) != BatchSize+1 {
+		t.Fatalf("Expected %d records with one invalid, got total=%d valid=%d stored=%d",
+			BatchSize+2, done.TotalRecords, done.ValidRecords, len(store.users))
+	}
+	if len(done.Errors) != 1 || done.Errors[0].Row != 3 || done.Errors[0].Field != "json" {
+		t.Errorf("Expected one JSON error on element 3, got %+v", done.Errors)
+	}
+
+	// Resume from the checkpoint after the first batch, which sits mid-array
+	content := readFile(t, path)
+	last := strings.Index(content, fmt.Sprintf(`"user%d@example.com"`, BatchSize))
+	checkpoint := models.ImportCheckpoint{
+		ByteOffset:   int64(last + strings.Index(content[last:], "}") + 1),
+		RowNumber:    BatchSize,
+		ValidRecords: BatchSize - 1,
+	}
+
+	resumeStore := &fakeStorage{}
+	resumed := jm.CreateImportJob("users", "json", path)
+	resumed.Checkpoint = &checkpoint
+	if err := NewProcessor(resumeStore, jm, t.TempDir()).ProcessImport(context.Background(), resumed); err != nil {
+		t.Fatalf("Expected no error on resume, got: %v", err)
+	}
+	if len(resumeStore.users) != 2 || resumeStore.users[0].Email != fmt.Sprintf("user%d@example.com", BatchSize+1) {
+		t.Errorf("Expected the 2 elements after the checkpoint, got %+v", resumeStore.users)
+	}
+}
+
+func TestImportCompressedFiles(t *testing.T) {
+	plain := readFile(t, writeUsersCSV(t, BatchSize+10))
+	dir := t.TempDir()
+
+	var gz bytes.Buffer
+	gzWriter := gzip.NewWriter(&gz)
+	gzWriter.Write([]byte(plain))
+	gzWriter.Close()
+
+	zstdWriter, _ := zstd.NewWriter(nil)
+	zst := zstdWriter.EncodeAll([]byte(plain), nil)
+
+	var zipped bytes.Buffer
+	zipWriter := zip.NewWriter(&zipped)
+	entry, _ := zipWriter.Create("users.csv")
+	entry.Write([]byte(plain))
+	zipWriter.Close()
+
+	files := map[string][]byte{
+		"users.csv.gz":  gz.Bytes(),
+		"users.csv.zst": zst,
+		"users.zip":     zipped.Bytes(),
+		"users.data":    gz.Bytes(), // detected by magic bytes alone
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		store := &fakeStorage{}
+		jm := jobs.NewJobManager()
+		job := jm.CreateImportJob("users", "csv", path)
+		if err := NewProcessor(store, jm, dir).ProcessImport(context.Background(), job); err != nil {
+			t.Fatalf("Import of %s failed: %v", name, err)
+		}
+		done, _ := jm.GetImportJob(job.ID)
+		if len(store.users) != BatchSize+10 || done.Status != "completed" || done.BytesProcessed != int64(len(data)) {
+			t.Errorf("Expected %s to import %d users through %d bytes, got %d users, status %s, %d bytes",
+				name, BatchSize+10, len(data), len(store.users), done.Status, done.BytesProcessed)
+		}
+
+		// The checkpoint points into the decompressed content, so resuming skips ahead in it
+		offset := int64(strings.Index(plain, fmt.Sprintf("user%d@example.com", BatchSize+1)))
+		resumeStore := &fakeStorage{}
+		resumed := jm.CreateImportJob("users", "csv", path)
+		resumed.Checkpoint = &models.ImportCheckpoint{ByteOffset: offset, RowNumber: BatchSize, ValidRecords: BatchSize}
+		if err := NewProcessor(resumeStore, jm, dir).ProcessImport(context.Background(), resumed); err != nil {
+			t.Fatalf("Resume of %s failed: %v", name, err)
+		}
+		if len(resumeStore.users) != 10 {
+			t.Errorf("Expected resuming %s to import the last 10 users, got %d", name, len(resumeStore.users))
+		}
+	}
+
+	// A file that expands past the limit fails the job
+	path := filepath.Join(dir, "users.csv.gz")
+	jm := jobs.NewJobManager()
+	job := jm.CreateImportJob("users", "csv", path)
+	processor := NewProcessor(&fakeStorage{}, jm, dir)
+	processor.SetMaxDecompressedSize(int64(len(plain) / 2))
+	if err := processor.ProcessImport(context.Background(), job); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("Expected ErrDecompressedTooLarge, got %v", err)
+	}
+}
+
+func TestImportAndExportWithObjectStore(t *testing.T) {
+	server := s3test.NewServer("minioadmin")
+	defer server.Close()
+	objects, err := s3.New(s3.Config{Endpoint: server.URL, AccessKeyID: "minioadmin", SecretAccessKey: "minioadmin", PathStyle: true})
+	if err != nil {
+		t.Fatalf("s3.New failed: %v", err)
+	}
+
+	plain := readFile(t, writeUsersCSV(t, BatchSize+10))
+	var zipped bytes.Buffer
+	zipWriter := zip.NewWriter(&zipped)
+	entry, _ := zipWriter.Create("users.csv")
+	entry.Write([]byte(plain))
+	zipWriter.Close()
+	server.Put("imports", "2024/users.csv", []byte(plain))
+	server.Put("imports", "2024/users.zip", zipped.Bytes())
+
+	// Objects are read in place, including the directory at the end of a zip archive
+	for _, location := range []string{"s3://imports/2024/users.csv", "s3://imports/2024/users.zip"} {
+		store := &fakeStorage{}
+		jm := jobs.NewJobManager()
+		processor := NewProcessor(store, jm, t.TempDir())
+		processor.SetObjectStore(objects)
+
+		if err := processor.CheckImportObject(context.Background(), location); err != nil {
+			t.Fatalf("CheckImportObject of %s failed: %v", location, err)
+		}
+		job := jm.CreateImportJob("users", "csv", location)
+		if err := processor.ProcessImport(context.Background(), job); err != nil {
+			t.Fatalf("Import of %s failed: %v", location, err)
+		}
+		if done, _ := jm.GetImportJob(job.ID); len(store.users) != BatchSize+10 || done.Status != "completed" || done.FileName != filepath.Base(location) {
+			t.Errorf("Expected %s to import %d users, got %d users, status %s", location, BatchSize+10, len(store.users), done.Status)
+		}
+	}
+
+	// A checkpoint resumes with a read from its offset
+	store := &fakeStorage{}
+	jm := jobs.NewJobManager()
+	processor := NewProcessor(store, jm, t.TempDir())
+	processor.SetObjectStore(objects)
+	offset := int64(strings.Index(plain, fmt.Sprintf("user%d@example.com", BatchSize+1)))
+	resumed := jm.CreateImportJob("users", "csv", "s3://imports/2024/users.csv")
+	resumed.Checkpoint = &models.ImportCheckpoint{ByteOffset: offset, RowNumber: BatchSize, ValidRecords: BatchSize}
+	if err := processor.ProcessImport(context.Background(), resumed); err != nil || len(store.users) != 10 {
+		t.Errorf("Expected resuming to import the last 10 users, got %d, %v", len(store.users), err)
+	}
+
+	if err := processor.CheckImportObject(context.Background(), "s3://imports/2024/missing.csv"); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("Expected s3.ErrNotFound for a missing object, got %v", err)
+	}
+	unconfigured := NewProcessor(&fakeStorage{}, jm, t.TempDir())
+	if err := unconfigured.CheckImportObject(context.Background(), "s3://imports/2024/users.csv"); !errors.Is(err, ErrObjectStoreNotConfigured) {
+		t.Errorf("Expected ErrObjectStoreNotConfigured without an object store, got %v", err)
+	}
+
+	// Exports are uploaded under the export location and only appear once complete
+	processor.SetExportLocation("s3://exports/nightly/")
+	file, location, err := processor.createExportFile(context.Background(), "users_csv_1.csv", "")
+	if err != nil {
+		t.Fatalf("createExportFile failed: %v", err)
+	}
+	if location != "s3://exports/nightly/users_csv_1.csv" {
+		t.Errorf("Expected the export to be located at s3://exports/nightly/users_csv_1.csv, got %s", location)
+	}
+	fmt.Fprint(file, plain)
+	if _, exists := server.Object("exports", "nightly/users_csv_1.csv"); exists {
+		t.Error("Expected the export to stay hidden until it is complete")
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, _ := server.Object("exports", "nightly/users_csv_1.csv"); string(got) != plain {
+		t.Errorf("Expected the uploaded export to hold the written content, got %d bytes", len(got))
+	}
+
+	failed, _, _ := processor.createExportFile(context.Background(), "users_csv_2.csv", "")
+	fmt.Fprint(failed, plain)
+	failed.Abort()
+	if _, exists := server.Object("exports", "nightly/users_csv_2.csv"); exists {
+		t.Error("Expected an aborted export to leave no object")
+	}
+
+	// A job's own destination overrides the export location, whether a bucket prefix or the export directory
+	for destination, expected := range map[string]string{
+		"s3://reports/adhoc":   "s3://reports/adhoc/users_csv_3.csv",
+		LocalExportDestination: "/downloads/users_csv_3.csv",
+	} {
+		if err := processor.CheckExportDestination(destination); err != nil {
+			t.Errorf("Expected destination %s to be accepted, got %v", destination, err)
+		}
+		file, location, err := processor.createExportFile(context.Background(), "users_csv_3.csv", destination)
+		if err != nil || location != expected {
+			t.Fatalf("Expected the export at %s, got %s, %v", expected, location, err)
+		}
+		file.Close()
+	}
+	if err := processor.CheckExportDestination("/var/exports"); err == nil {
+		t.Error("Expected a destination that is not an s3:// URL to be rejected")
+	}
+	if err := unconfigured.CheckExportDestination("s3://reports/adhoc"); !errors.Is(err, ErrObjectStoreNotConfigured) {
+		t.Errorf("Expected ErrObjectStoreNotConfigured without an object store, got %v", err)
+	}
+}
+
+func TestImportStreamSpoolsPastThreshold(t *testing.T) {
+	comment := `{"article_id":"6f1c2a52-4f0e-4a8e-9d6a-2f1f1b2c3d4e","user_id":"7a2d3b63-5f1f-4b9f-8e7b-3a2a2c3d4e5f","body":"Nice"}` + "\n"
+	jm := jobs.NewJobManager()
+
+	// A body within the threshold is imported from memory, BOM and all
+	dir := t.TempDir()
+	store := &fakeStorage{}
+	stream := NewImportStream(strings.NewReader("\ufeff"+comment+comment), 1024, dir)
+	job := jm.CreateImportJob("comments", "ndjson", "")
+	if err := NewProcessor(store, jm, t.TempDir()).ProcessImportStream(context.Background(), job, stream, 0); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	stream.Close()
+	if done, _ := jm.GetImportJob(job.ID); len(store.comments) != 2 || done.ErrorRecords != 0 {
+		t.Errorf("Expected 2 comments imported cleanly, got %d and %+v", len(store.comments), done.Errors)
+	}
+	select {
+	case <-stream.Spilled():
+		t.Error("Expected a short body not to spill")
+	default:
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no spool file, got %d files", len(entries))
+	}
+
+	// A longer body is spooled, and the import reads on from the spool file
+	body := strings.Repeat(comment, BatchSize+5)
+	reader, writer := io.Pipe()
+	go func() {
+		for i := 0; i < len(body); i += 4096 {
+			writer.Write([]byte(body[i:min(i+4096, len(body))]))
+		}
+		writer.Close()
+	}()
+	store = &fakeStorage{}
+	stream = NewImportStream(reader, int64(len(comment)*3), dir)
+	job = jm.CreateImportJob("comments", "ndjson", "")
+	result := make(chan error, 1)
+	go func() {
+		result <- NewProcessor(store, jm, t.TempDir()).ProcessImportStream(context.Background(), job, stream, int64(len(body)))
+	}()
+
+	<-stream.Spilled()
+	var spooled string
+	if err := stream.Drain(func(path string) { spooled = path }); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	stream.Close()
+	if len(store.comments) != BatchSize+5 {
+		t.Errorf("Expected %d comments, got %d", BatchSize+5, len(store.comments))
+	}
+	if spooled == "" || readFile(t, spooled) != body {
+		t.Errorf("Expected the whole body in the spool file %q", spooled)
+	}
+
+	// A body cut off after spilling fails the import and leaves no spool file
+	reader, writer = io.Pipe()
+	go func() {
+		writer.Write([]byte(body[:len(comment)*4]))
+		writer.CloseWithError(io.ErrUnexpectedEOF)
+	}()
+	dir = t.TempDir()
+	stream = NewImportStream(reader, int64(len(comment)*3), dir)
+	job = jm.CreateImportJob("comments", "ndjson", "")
+	go func() {
+		result <- NewProcessor(&fakeStorage{}, jm, t.TempDir()).ProcessImportStream(context.Background(), job, stream, 0)
+	}()
+	<-stream.Spilled()
+	if err := stream.Drain(func(string) { t.Error("Expected a cut off body not to be spooled") }); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected Drain to fail with the body's error, got %v", err)
+	}
+	if err := <-result; !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected the import to fail with the body's error, got %v", err)
+	}
+	stream.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the spool file to be removed, got %d files", len(entries))
+	}
+}
+
+func TestImportCSVDialectAndCharset(t *testing.T) {
+	plain := readFile(t, writeUsersCSV(t, BatchSize+10))
+	latin1, _ := charmap.ISO8859_1.NewEncoder().String(",zoe@example.com,Zoë,reader,true,,\n")
+	utf16, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(plain)
+
+	cases := []struct {
+		name    string
+		data    string
+		options models.ImportOptions
+		users   int
+		first   string // name of the first user imported
+	}{
+		{
+			name:    "semicolons.csv",
+			data:    "\ufeffemail;name;role;active\n# exported from Excel\nann@example.com;Ann;admin;true\n",
+			options: models.ImportOptions{Delimiter: ";", Comment: "#"},
+			users:   1,
+			first:   "Ann",
+		},
+		{
+			name:    "latin1.csv",
+			data:    latin1,
+			options: models.ImportOptions{NoHeader: true, Charset: "latin1"},
+			users:   1,
+			first:   "Zoë",
+		},
+		{
+			name:  "utf16.csv", // the byte order mark alone gives the encoding
+			data:  utf16,
+			users: BatchSize + 10,
+			first: "User 1",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, tc := range cases {
+		if err := ValidateImportOptions(tc.options); err != nil {
+			t.Fatalf("Expected options of %s to be valid, got: %v", tc.name, err)
+		}
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, []byte(tc.data), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		store := &fakeStorage{}
+		jm := jobs.NewJobManager()
+		job := jm.CreateImportJob("users", "csv", path)
+		job.Options = tc.options
+		if err := NewProcessor(store, jm, dir).ProcessImport(context.Background(), job); err != nil {
+			t.Fatalf("Import of %s failed: %v", tc.name, err)
+		}
+		done, _ := jm.GetImportJob(job.ID)
+		if len(store.users) != tc.users || done.ErrorRecords != 0 {
+			t.Fatalf("Expected %s to import %d users cleanly, got %d and %+v", tc.name, tc.users, len(store.users), done.Errors)
+		}
+		if store.users[0].Name != tc.first {
+			t.Errorf("Expected %s to start with %q, got %q", tc.name, tc.first, store.users[0].Name)
+		}
+	}
+
+	// The checkpoint points into the transcoded content, so resuming skips ahead in it
+	offset := int64(strings.Index(plain, fmt.Sprintf("user%d@example.com", BatchSize+1)))
+	store := &fakeStorage{}
+	jm := jobs.NewJobManager()
+	resumed := jm.CreateImportJob("users", "csv", filepath.Join(dir, "utf16.csv"))
+	resumed.Checkpoint = &models.ImportCheckpoint{ByteOffset: offset, RowNumber: BatchSize, ValidRecords: BatchSize}
+	if err := NewProcessor(store, jm, dir).ProcessImport(context.Background(), resumed); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if len(store.users) != 10 || store.users[0].Email != fmt.Sprintf("user%d@example.com", BatchSize+1) {
+		t.Errorf("Expected resuming to import the last 10 users, got %d", len(store.users))
+	}
+
+	for _, options := range []models.ImportOptions{
+		{Delimiter: ";;"},
+		{Delimiter: "\""},
+		{Comment: ","},
+		{Charset: "klingon"},
+	} {
+		if err := ValidateImportOptions(options); err == nil {
+			t.Errorf("Expected %+v to be rejected", options)
+		}
+	}
+}
+
+func TestImportColumnMapping(t *testing.T) {
+	dir := t.TempDir()
+	crm := map[string]string{"Email Address": "email", "Full Name": "name", "Is Enabled": "active"}
+
+	files := map[string]struct {
+		data    string
+		mapping map[string]string
+	}{
+		"crm.csv": {
+			data:    "Email Address,Full Name,Is Enabled,role,Phone\nann@example.com,Ann,true,admin,555-0100\n",
+			mapping: crm,
+		},
+		"crm.ndjson": {
+			data:    `{"contact":{"email":"bob@example.com"},"Full Name":"Bob","role":"reader","Phone":"555-0101"}` + "\n",
+			mapping: map[string]string{"contact.email": "email", "Full Name": "name"},
+		},
+	}
+	for name, file := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(file.data), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		_, format, _ := strings.Cut(name, ".")
+		options := models.ImportOptions{Mapping: file.mapping}
+		if err := ValidateMapping("users", format, options.Mapping, false); err != nil {
+			t.Fatalf("Expected mapping of %s to be valid, got: %v", name, err)
+		}
+
+		store := &fakeStorage{}
+		jm := jobs.NewJobManager()
+		processor := NewProcessor(store, jm, dir)
+		warnings, err := processor.CheckMapping(context.Background(), path, "users", format, options)
+		if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], `"Phone"`) {
+			t.Fatalf("Expected %s to warn about Phone only, got %v and %v", name, warnings, err)
+		}
+
+		job := jm.CreateImportJob("users", format, path)
+		job.Options = options
+		if err := processor.ProcessImport(context.Background(), job); err != nil {
+			t.Fatalf("Import of %s failed: %v", name, err)
+		}
+		done, _ := jm.GetImportJob(job.ID)
+		if len(store.users) != 1 || done.ErrorRecords != 0 || len(done.Warnings) != 1 {
+			t.Fatalf("Expected %s to import 1 user with 1 warning, got %d, %+v and %v", name, len(store.users), done.Errors, done.Warnings)
+		}
+		if user := store.users[0]; !strings.HasSuffix(user.Email, "@example.com") || user.Name == "" || user.Role == "" {
+			t.Errorf("Expected %s to fill every mapped field, got %+v", name, user)
+		}
+	}
+
+	// A mapping that leaves a required field empty is rejected before the import
+	path := filepath.Join(dir, "crm.csv")
+	_, err := NewProcessor(&fakeStorage{}, jobs.NewJobManager(), dir).CheckMapping(context.Background(), path, "users", "csv",
+		models.ImportOptions{Mapping: map[string]string{"Email Address": "email", "role": "name"}})
+	if err == nil || !strings.Contains(err.Error(), "role") {
+		t.Errorf("Expected the unmapped role field to be reported, got %v", err)
+	}
+
+	for _, mapping := range []map[string]string{
+		{"Email Address": "mail"},
+		{"Email Address": "email", "E-mail": "email"},
+	} {
+		if err := ValidateMapping("users", "csv", mapping, false); err == nil {
+			t.Errorf("Expected %v to be rejected", mapping)
+		}
+	}
+	if err := ValidateMapping("bundle", "zip", crm, false); err == nil {
+		t.Error("Expected a mapping to be rejected for bundles")
+	}
+}
+
+func TestImportFieldTransforms(t *testing.T) {
+	dir := t.TempDir()
+	transforms := map[string][]models.FieldTransform{
+		"email":      {{Op: "trim"}, {Op: "lower"}},
+		"name":       {{Op: "replace", Pattern: `^Dr\.? `, Replacement: ""}},
+		"role":       {{Op: "lower"}, {Op: "default", Value: "reader"}},
+		"active":     {{Op: "map", Values: map[string]string{"Yes": "true", "No": "false"}}},
+		"created_at": {{Op: "date", Layout: "02/01/2006"}},
+	}
+	if err := ValidateTransforms("users", transforms); err != nil {
+		t.Fatalf("Expected transforms to be valid, got: %v", err)
+	}
+
+	files := map[string]string{
+		"users.csv":    "email,name,role,active,created_at\n ANN@Example.com ,Dr. Ann,ADMIN,Yes,16/10/2026\nbob@example.com,Bob,,No,\n",
+		"users.ndjson": `{"email":" ANN@Example.com ","name":"Dr. Ann","role":"ADMIN","active":"Yes","created_at":"16/10/2026"}` + "\n" + `{"email":"bob@example.com","name":"Bob","active":false}` + "\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		_, format, _ := strings.Cut(name, ".")
+
+		store := &fakeStorage{}
+		jm := jobs.NewJobManager()
+		job := jm.CreateImportJob("users", format, path)
+		job.Options = models.ImportOptions{Transforms: transforms}
+		if err := NewProcessor(store, jm, dir).ProcessImport(context.Background(), job); err != nil {
+			t.Fatalf("Import of %s failed: %v", name, err)
+		}
+		done, _ := jm.GetImportJob(job.ID)
+		if len(store.users) != 2 || done.ErrorRecords != 0 {
+			t.Fatalf("Expected %s to import 2 users, got %d and %+v", name, len(store.users), done.Errors)
+		}
+
+		ann, bob := store.users[0], store.users[1]
+		created := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+		if ann.Email != "ann@example.com" || ann.Name != "Ann" || ann.Role != "admin" || !ann.Active || !ann.CreatedAt.Equal(created) {
+			t.Errorf("Expected %s to transform Ann, got %+v", name, ann)
+		}
+		if bob.Role != "reader" || bob.Active {
+			t.Errorf("Expected %s to default Bob's role, got %+v", name, bob)
+		}
+
+		changed := make(map[string]int)
+		for _, count := range done.TransformCounts {
+			changed[fmt.Sprintf("%s/%d/%s", count.Field, count.Step, count.Op)] = count.Changed
+		}
+		want := map[string]int{
+			"email/0/trim": 1, "email/1/lower": 1, "name/0/replace": 1, "role/0/lower": 1,
+			"role/1/default": 1, "active/0/map": 1, "created_at/0/date": 1,
+		}
+		if name == "users.csv" {
+			want["active/0/map"] = 2 // "No" is text in CSV but a boolean in the NDJSON file
+		}
+		if !maps.Equal(changed, want) {
+			t.Errorf("Expected %s to count %v, got %v", name, want, changed)
+		}
+	}
+
+	for _, invalid := range []map[string][]models.FieldTransform{
+		{"mail": {{Op: "trim"}}},
+		{"email": {{Op: "titlecase"}}},
+		{"active": {{Op: "map"}}},
+		{"role": {{Op: "default"}}},
+		{"name": {{Op: "replace", Pattern: "("}}},
+		{"created_at": {{Op: "date"}}},
+	} {
+		if err := ValidateTransforms("users", invalid); err == nil {
+			t.Errorf("Expected %v to be rejected", invalid)
+		}
+	}
+}
+
+func TestPreviewImport(t *testing.T) {
+	dir := t.TempDir()
+	crm, err := charmap.Windows1252.NewEncoder().String(
+		"Email Address;Full Name;Role;Notes\nzoe@example.com;Zoë;admin;\"a; b\"\nnot-an-email;Max;reader;\n")
+	if err != nil {
+		t.Fatalf("Failed to encode test file: %v", err)
+	}
+	csvPath := filepath.Join(dir, "crm.csv")
+	if err := os.WriteFile(csvPath, []byte(crm), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	store := &fakeStorage{}
+	processor := NewProcessor(store, jobs.NewJobManager(), dir)
+	preview, err := processor.PreviewImport(context.Background(), csvPath, "crm.csv", "users", "", models.ImportOptions{}, 0)
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if preview.Format != "csv" || preview.Charset != "windows-1252" || preview.Delimiter != ";" {
+		t.Errorf("Expected csv, windows-1252 and ';' to be detected, got %s, %s and %q", preview.Format, preview.Charset, preview.Delimiter)
+	}
+	wantMapping := map[string]string{"Email Address": "email", "Full Name": "name", "Role": "role"}
+	if !maps.Equal(preview.SuggestedMapping, wantMapping) || !slices.Equal(preview.UnmappedColumns, []string{"Notes"}) {
+		t.Errorf("Expected mapping %v leaving Notes unmapped, got %v and %v", wantMapping, preview.SuggestedMapping, preview.UnmappedColumns)
+	}
+	if len(preview.Rows) != 2 || preview.ValidRows != 1 || !preview.Rows[0].Valid || preview.Rows[1].Valid {
+		t.Fatalf("Expected the first of 2 rows to be valid, got %+v", preview.Rows)
+	}
+	if user, ok := preview.Rows[0].Record.(models.User); !ok || user.Name != "Zoë" {
+		t.Errorf("Expected the first row to be decoded, got %+v", preview.Rows[0].Record)
+	}
+	if errs := preview.Rows[1].Errors; len(errs) != 1 || errs[0].Field != "email" {
+		t.Errorf("Expected the second row to fail on email, got %+v", errs)
+	}
+	if len(store.users) != 0 {
+		t.Error("Expected a preview to write nothing")
+	}
+
+	// A gzipped NDJSON file is recognised by its content, and nested keys by their last part
+	var zipped bytes.Buffer
+	gz := gzip.NewWriter(&zipped)
+	gz.Write([]byte(`{"contact":{"mail":"ann@example.com"},"name":"Ann"}` + "\n" + `{"name":"Bob","role":"reader"}` + "\n"))
+	gz.Close()
+	ndjsonPath := filepath.Join(dir, "upload.bin")
+	if err := os.WriteFile(ndjsonPath, zipped.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	preview, err = processor.PreviewImport(context.Background(), ndjsonPath, "upload.bin", "users", "", models.ImportOptions{}, 1)
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if preview.Format != "ndjson" || preview.Compression != "gzip" || len(preview.Rows) != 1 {
+		t.Errorf("Expected 1 row of gzipped NDJSON, got %s, %s and %d rows", preview.Format, preview.Compression, len(preview.Rows))
+	}
+	if preview.SuggestedMapping["contact.mail"] != "email" || !slices.Equal(preview.MissingFields, []string{"role"}) {
+		t.Errorf("Expected contact.mail to map to email and role to be missing, got %v and %v", preview.SuggestedMapping, preview.MissingFields)
+	}
+
+	if _, err := processor.PreviewImport(context.Background(), csvPath, "crm.csv", "bundle", "", models.ImportOptions{}, 0); err == nil {
+		t.Error("Expected bundles to be rejected")
+	}
+}
+
+func TestExtractBundle(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "dataset.zip")
+
+	var zipped bytes.Buffer
+	zipWriter := zip.NewWriter(&zipped)
+	for name, content := range map[string]string{
+		"export/comments.ndjson":      `{"id":"c1"}`,
+		"export/users.csv":            "id,email\n",
+		"__MACOSX/export/._users.csv": "resource fork",
+	} {
+		entry, _ := zipWriter.Create(name)
+		entry.Write([]byte(content))
+	}
+	zipWriter.Close()
+	if err := os.WriteFile(archivePath, zipped.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	processor := NewProcessor(&fakeStorage{}, jobs.NewJobManager(), dir)
+	files, err := processor.ExtractBundle(archivePath, "zip", filepath.Join(dir, "bundle"))
+	if err != nil {
+		t.Fatalf("Expected bundle to extract, got: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected users and comments files, got %+v", files)
+	}
+	for _, file := range files {
+		if filepath.Dir(file.Path) != filepath.Join(dir, "bundle") {
+			t.Errorf("Expected %s to be extracted into the bundle directory", file.Path)
+		}
+		if (file.ResourceType == "users") != (file.Format == "csv") {
+			t.Errorf("Unexpected bundle file %+v", file)
+		}
+	}
+
+	// A file that isn't named after a resource is rejected
+	if _, _, err := bundleMember("export/readme.txt"); err == nil {
+		t.Errorf("Expected an unrecognised file to be rejected")
+	}
+}
+
+func TestImportTrackerProgress(t *testing.T) {
+	tracker := newImportTracker(1000, models.ImportCheckpoint{ByteOffset: 200, RowNumber: 20})
+
+	if progress := tracker.progress(500); progress != 50 {
+		t.Errorf("Expected 50%% at half the file, got %d", progress)
+	}
+	if progress := tracker.progress(1000); progress != 99 {
+		t.Errorf("Expected progress to stay below 100 until completion, got %d", progress)
+	}
+
+	tracker.startedAt = tracker.startedAt.Add(-2 * time.Second)
+	rowsPerSecond, remaining := tracker.throughput(600, 60)
+	if rowsPerSecond < 19 || rowsPerSecond > 20 {
+		t.Errorf("Expected about 20 rows/s for 40 rows in 2s, got %.1f", rowsPerSecond)
+	}
+	// 400 bytes took 2s, so the remaining 400 should take about as long
+	if remaining < 1900*time.Millisecond || remaining > 2100*time.Millisecond {
+		t.Errorf("Expected about 2s remaining, got %v", remaining)
+	}
+
+	if progress := exportProgress(250, 1000); progress != 25 {
+		t.Errorf("Expected 25%% export progress, got %d", progress)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,60 @@
+package streaming
+
+import (
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// importTracker turns the bytes an import has consumed from its source file
+// into a progress percentage, a row rate and an estimated time remaining
+type importTracker struct {
+	fileSize    int64
+	startOffset int64 // where this run started, so a resumed job's rate only counts its own rows
+	startRows   int
+	startedAt   time.Time
+}
+
+// newImportTracker starts tracking an import of a file of the given size
+func newImportTracker(fileSize int64, start models.ImportCheckpoint) *importTracker {
+	return &importTracker{
+		fileSize:    fileSize,
+		startOffset: start.ByteOffset,
+		startRows:   start.RowNumber,
+		startedAt:   time.Now(),
+	}
+}
+
+// progress returns the percentage of the file consumed at offset. It stays
+// below 100 until the job is marked completed.
+func (t *importTracker) progress(offset int64) int {
+	if t.fileSize <= 0 {
+		return 0
+	}
+	return min(99, int(offset*100/t.fileSize))
+}
+
+// throughput returns the row rate of this run and the estimated time left at offset
+func (t *importTracker) throughput(offset int64, rows int) (float64, time.Duration) {
+	elapsed := time.Since(t.startedAt)
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	rowsPerSecond := float64(rows-t.startRows) / elapsed.Seconds()
+
+	// Estimate from bytes rather than rows, since only the file size is known up front
+	var remaining time.Duration
+	if consumed := offset - t.startOffset; consumed > 0 && offset < t.fileSize {
+		remaining = time.Duration(float64(elapsed) * float64(t.fileSize-offset) / float64(consumed))
+	}
+	return rowsPerSecond, remaining
+}
+
+// exportProgress returns the percentage of an export's records written so
+// far. It stays below 100 until the job is marked completed.
+func exportProgress(processed, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	return min(99, processed*100/total)
+}
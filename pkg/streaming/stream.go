@@ -0,0 +1,242 @@
+package streaming
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// DefaultSpoolThreshold is how much of a streamed import is kept in memory
+// before the rest of the request body is spooled to disk
+const DefaultSpoolThreshold int64 = 8 * 1024 * 1024 // 8MB
+
+// ImportStream is the request body of a streamed import. The import reads the
+// body as it arrives, keeping what it has read in memory, so a small body
+// never touches disk. Once more than the spool threshold has been read, that
+// is written to a spool file, and Drain copies the rest of the body after it.
+// The import then reads on from the file, and the request can be answered
+// without waiting for the import to finish.
+type ImportStream struct {
+	body      io.Reader
+	threshold int64
+	dir       string
+	head      bytes.Buffer // what the import read before the stream spilled
+	read      int64        // bytes the import has read
+	spilled   chan struct{}
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	file    *os.File // spool file, once spilled
+	written int64    // bytes in the spool file
+	drained bool     // the whole body is in the spool file
+	err     error    // error reading the rest of the body
+}
+
+// NewImportStream reads an import from body, spooling it to a file in dir
+// once it grows past threshold
+func NewImportStream(body io.Reader, threshold int64, dir string) *ImportStream {
+	s := &ImportStream{body: body, threshold: threshold, dir: dir, spilled: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// Spilled is closed once the stream has grown past the spool threshold and
+// needs Drain to be called
+func (s *ImportStream) Spilled() <-chan struct{} {
+	return s.spilled
+}
+
+func (s *ImportStream) Read(p []byte) (int, error) {
+	s.mutex.Lock()
+	file := s.file
+	s.mutex.Unlock()
+
+	if file == nil {
+		n, err := s.body.Read(p)
+		s.read += int64(n)
+		s.head.Write(p[:n])
+		if err == nil && s.read > s.threshold {
+			err = s.spill()
+		}
+		return n, err
+	}
+
+	s.mutex.Lock()
+	for s.read >= s.written && !s.drained && s.err == nil {
+		s.cond.Wait()
+	}
+	available, err := s.written-s.read, s.err
+	s.mutex.Unlock()
+	if available == 0 {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > available {
+		p = p[:available]
+	}
+	n, err := file.ReadAt(p, s.read)
+	s.read += int64(n)
+	if errors.Is(err, io.EOF) {
+		err = nil // more of the body may still be on its way
+	}
+	return n, err
+}
+
+// spill writes what has been read so far to a new spool file
+func (s *ImportStream) spill() error {
+	file, err := os.CreateTemp(s.dir, "stream_*.part")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	if _, err := file.Write(s.head.Bytes()); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.file, s.written = file, int64(s.head.Len())
+	s.mutex.Unlock()
+	s.head = bytes.Buffer{}
+	close(s.spilled)
+	return nil
+}
+
+// Drain copies the rest of the body to the spool file, after the stream has
+// spilled. onSpooled is called with the path of the file once it holds the
+// whole body, before the import can reach its end.
+func (s *ImportStream) Drain(onSpooled func(path string)) error {
+	s.mutex.Lock()
+	file, offset := s.file, s.written
+	s.mutex.Unlock()
+
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := s.body.Read(buf)
+		if n > 0 {
+			if _, writeErr := file.WriteAt(buf[:n], offset); writeErr != nil {
+				err = fmt.Errorf("failed to write spool file: %w", writeErr)
+			}
+			offset += int64(n)
+		}
+
+		s.mutex.Lock()
+		s.written = offset
+		switch {
+		case errors.Is(err, io.EOF):
+			onSpooled(file.Name())
+			s.drained = true
+		case err != nil:
+			s.err = err
+		}
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close releases the spool file once the import is done with the stream. A
+// file that never received the whole body is no use for resuming, so it is
+// removed.
+func (s *ImportStream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	if !s.drained {
+		return os.Remove(s.file.Name())
+	}
+	return nil
+}
+
+// ProcessImportStream imports the records of a job as they are read from
+// body, rather than from its file. size is the length of the body, or 0 when
+// unknown. The body is read once, front to back, so the job can only be
+// resumed from its spool file.
+func (p *Processor) ProcessImportStream(ctx context.Context, job *models.ImportJob, body io.Reader, size int64) error {
+	if job.Options.DryRun {
+		dryRun := *p
+		dryRun.storage = newDryRunStorage(p.storage, p.jobManager, job.ID)
+		p = &dryRun
+	}
+	input, err := openStreamInput(body, size, job.Options)
+	if err != nil {
+		return err
+	}
+	return p.importContent(ctx, job, input, models.ImportCheckpoint{})
+}
+
+// openStreamInput decodes a body the way decodeText decodes a file, but
+// without going back over it: a byte order mark is looked at through a buffer
+// and skipped, and other charsets are transcoded as the body is read
+func openStreamInput(body io.Reader, size int64, options models.ImportOptions) (*importInput, error) {
+	enc, err := textEncoding(options.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &countingReader{reader: body}
+	buffered := bufio.NewReader(counter)
+	var content io.Reader = buffered
+	switch {
+	case enc != nil && options.KeepBOM:
+		content = transform.NewReader(buffered, enc.NewDecoder())
+	case enc != nil:
+		content = transform.NewReader(buffered, unicode.BOMOverride(enc.NewDecoder()))
+	case !options.KeepBOM:
+		bom, _ := buffered.Peek(len(utf8BOM))
+		if bytes.HasPrefix(bom, utf8BOM) {
+			buffered.Discard(len(utf8BOM))
+		} else if bytes.HasPrefix(bom, []byte{0xfe, 0xff}) || bytes.HasPrefix(bom, []byte{0xff, 0xfe}) {
+			content = transform.NewReader(buffered, unicode.BOMOverride(transform.Nop))
+		}
+	}
+
+	return &importInput{
+		ReadSeeker: forwardReader{content},
+		size:       size,
+		position:   func() int64 { return counter.read },
+	}, nil
+}
+
+// forwardReader is content that can only be read front to back
+type forwardReader struct {
+	io.Reader
+}
+
+func (forwardReader) Seek(offset int64, whence int) (int64, error) {
+	return 0, fmt.Errorf("a streamed import can't seek")
+}
+
+// countingReader counts the bytes read from a stream, to report import progress
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += int64(n)
+	return n, err
+}
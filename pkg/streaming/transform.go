@@ -0,0 +1,225 @@
+package streaming
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+)
+
+// booleanFields are the fields whose JSON values are booleans, so a
+// transformed value such as "true" is turned back into one
+var booleanFields = map[string]bool{"active": true}
+
+// ValidateTransforms checks the transforms of an import, including their patterns
+func ValidateTransforms(resourceType string, transforms map[string][]models.FieldTransform) error {
+	_, err := newFieldTransformer(resourceType, transforms)
+	return err
+}
+
+// fieldTransformer cleans up the raw values of a record before they are
+// parsed and validated, counting the values each step changed
+type fieldTransformer struct {
+	fields []string // fields with transforms, sorted
+	steps  map[string][]*transformStep
+}
+
+// transformStep is one compiled step of a field's transforms
+type transformStep struct {
+	op      string
+	apply   func(value string) string
+	changed int // values changed since the counts were last taken
+}
+
+// newFieldTransformer compiles the transforms of an import. It returns nil
+// when there are none, so records are read as they are.
+func newFieldTransformer(resourceType string, transforms map[string][]models.FieldTransform) (*fieldTransformer, error) {
+	if len(transforms) == 0 {
+		return nil, nil
+	}
+	fields, ok := resourceFields[resourceType]
+	if !ok {
+		return nil, fmt.Errorf("transforms are not supported for %s imports", resourceType)
+	}
+
+	t := &fieldTransformer{steps: make(map[string][]*transformStep)}
+	for _, field := range slices.Sorted(maps.Keys(transforms)) {
+		if !slices.Contains(fields, field) {
+			return nil, fmt.Errorf("cannot transform %q, which is not a %s field", field, resourceType)
+		}
+		for i, spec := range transforms[field] {
+			apply, err := compileTransform(spec)
+			if err != nil {
+				return nil, fmt.Errorf("transform %d of %s: %w", i, field, err)
+			}
+			t.steps[field] = append(t.steps[field], &transformStep{op: spec.Op, apply: apply})
+		}
+		t.fields = append(t.fields, field)
+	}
+	return t, nil
+}
+
+// compileTransform returns the function a transform step applies to a value
+func compileTransform(spec models.FieldTransform) (func(string) string, error) {
+	switch spec.Op {
+	case "trim":
+		return strings.TrimSpace, nil
+	case "lower":
+		return strings.ToLower, nil
+	case "upper":
+		return strings.ToUpper, nil
+	case "map":
+		if len(spec.Values) == 0 {
+			return nil, fmt.Errorf("map needs values")
+		}
+		return func(value string) string {
+			if replacement, ok := spec.Values[value]; ok {
+				return replacement
+			}
+			return value
+		}, nil
+	case "default":
+		if spec.Value == "" {
+			return nil, fmt.Errorf("default needs a value")
+		}
+		return func(value string) string {
+			if strings.TrimSpace(value) == "" {
+				return spec.Value
+			}
+			return value
+		}, nil
+	case "replace":
+		if spec.Pattern == "" {
+			return nil, fmt.Errorf("replace needs a pattern")
+		}
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return func(value string) string {
+			return pattern.ReplaceAllString(value, spec.Replacement)
+		}, nil
+	case "date":
+		if spec.Layout == "" {
+			return nil, fmt.Errorf("date needs a layout")
+		}
+		return func(value string) string {
+			parsed, err := time.Parse(spec.Layout, value)
+			if err != nil {
+				return value // left for parsing to reject
+			}
+			return parsed.Format(time.RFC3339)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q; expected trim, lower, upper, map, default, replace or date", spec.Op)
+	}
+}
+
+// value runs a field's steps over one value, counting the steps that changed it
+func (t *fieldTransformer) value(field, value string) string {
+	for _, step := range t.steps[field] {
+		if next := step.apply(value); next != value {
+			step.changed++
+			value = next
+		}
+	}
+	return value
+}
+
+// defaultFields returns the fields with a default step, which are filled even
+// when a record doesn't have them
+func (t *fieldTransformer) defaultFields() []string {
+	if t == nil {
+		return nil
+	}
+	var fields []string
+	for _, field := range t.fields {
+		if slices.ContainsFunc(t.steps[field], func(step *transformStep) bool { return step.op == "default" }) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// addDefaultColumns gives each field with a default but no column of its own
+// an extra column past the end of the header, for csvRecord to fill
+func (t *fieldTransformer) addDefaultColumns(colIndex map[string]int, width int) {
+	for _, field := range t.defaultFields() {
+		if _, ok := colIndex[field]; !ok {
+			colIndex[field] = width
+			width++
+		}
+	}
+}
+
+// csvRecord transforms the columns of a CSV record
+func (t *fieldTransformer) csvRecord(record []string, colIndex map[string]int) []string {
+	for _, field := range t.fields {
+		idx, ok := colIndex[field]
+		if !ok {
+			continue
+		}
+		for len(record) <= idx {
+			record = append(record, "")
+		}
+		record[idx] = t.value(field, record[idx])
+	}
+	return record
+}
+
+// jsonRecord transforms the values of a decoded JSON record. Strings and
+// booleans are transformed as text, and lists of strings element by element.
+func (t *fieldTransformer) jsonRecord(record map[string]any) {
+	for _, field := range t.fields {
+		switch value := record[field].(type) {
+		case nil:
+			if slices.Contains(t.defaultFields(), field) {
+				record[field] = t.jsonValue(field, "")
+			}
+		case string:
+			record[field] = t.jsonValue(field, value)
+		case bool:
+			record[field] = t.jsonValue(field, strconv.FormatBool(value))
+		case []any:
+			for i, element := range value {
+				if text, ok := element.(string); ok {
+					value[i] = t.value(field, text)
+				}
+			}
+		}
+	}
+}
+
+// jsonValue transforms a JSON value, turning the result back into a boolean
+// for a boolean field
+func (t *fieldTransformer) jsonValue(field, value string) any {
+	value = t.value(field, value)
+	if booleanFields[field] {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return value
+}
+
+// takeCounts returns the values each step changed since the last call
+func (t *fieldTransformer) takeCounts() []models.TransformCount {
+	if t == nil {
+		return nil
+	}
+	var counts []models.TransformCount
+	for _, field := range t.fields {
+		for i, step := range t.steps[field] {
+			if step.changed > 0 {
+				counts = append(counts, models.TransformCount{Field: field, Step: i, Op: step.op, Changed: step.changed})
+				step.changed = 0
+			}
+		}
+	}
+	return counts
+}
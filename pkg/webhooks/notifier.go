@@ -0,0 +1,233 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/fetch"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of a delivery
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the Unix time the signature was computed at
+	TimestampHeader = "X-Webhook-Timestamp"
+	// EventHeader names the event being delivered
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader carries the unique ID of a delivery
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	// attemptTimeout bounds a single delivery attempt
+	attemptTimeout = 10 * time.Second
+)
+
+// Payload is the JSON body POSTed to a callback URL
+type Payload struct {
+	Event     string      `json:"event"` // e.g. import.completed, export.failed
+	JobType   string      `json:"job_type"`
+	Job       interface{} `json:"job"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Delivery records one attempt to deliver a webhook
+type Delivery struct {
+	ID         string    `json:"id"`
+	JobID      string    `json:"job_id"`
+	Event      string    `json:"event"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"duration_ms"`
+	AttemptAt  time.Time `json:"attempted_at"`
+}
+
+// Notifier POSTs signed job summaries to callback URLs when jobs finish
+type Notifier struct {
+	fetcher       *fetch.Fetcher // keeps deliveries off private networks
+	defaultSecret string         // used when a job has no secret of its own
+	maxAttempts   int            // attempts per delivery, including the first
+	backoff       time.Duration  // delay before the first retry, doubled on every retry
+	deliveries    map[string][]Delivery
+	mutex         sync.RWMutex
+}
+
+// NewNotifier creates a webhook notifier. defaultSecret signs deliveries for
+// jobs created without their own callback secret; empty disables signing for them.
+// Callback URLs are held to the default fetch policy until SetFetcher is called.
+func NewNotifier(defaultSecret string) *Notifier {
+	return &Notifier{
+		fetcher:       fetch.New(fetch.DefaultConfig()),
+		defaultSecret: defaultSecret,
+		maxAttempts:   5,
+		backoff:       2 * time.Second,
+		deliveries:    make(map[string][]Delivery),
+	}
+}
+
+// SetFetcher sets the fetcher deliveries are made with, and so the policy
+// callback URLs, their redirects and the addresses they resolve to are held to
+func (n *Notifier) SetFetcher(fetcher *fetch.Fetcher) {
+	n.fetcher = fetcher
+}
+
+// CheckURL reports whether a callback URL may be delivered to, judging by its
+// scheme and host. Addresses are checked when each delivery connects.
+func (n *Notifier) CheckURL(rawURL string) error {
+	return n.fetcher.CheckURL(rawURL)
+}
+
+// ImportJobFinished delivers the summary of a finished import job
+func (n *Notifier) ImportJobFinished(job models.ImportJob) {
+	if job.CallbackURL == "" {
+		return
+	}
+	payload := Payload{
+		Event:     "import." + job.Status,
+		JobType:   "import",
+		Job:       job.Summary(),
+		Timestamp: time.Now().UTC(),
+	}
+	go n.deliver(job.ID, job.CallbackURL, job.CallbackSecret, payload)
+}
+
+// ExportJobFinished delivers the summary of a finished export job
+func (n *Notifier) ExportJobFinished(job models.ExportJob) {
+	if job.CallbackURL == "" {
+		return
+	}
+	payload := Payload{
+		Event:     "export." + job.Status,
+		JobType:   "export",
+		Job:       job.Summary(),
+		Timestamp: time.Now().UTC(),
+	}
+	go n.deliver(job.ID, job.CallbackURL, job.CallbackSecret, payload)
+}
+
+// Deliveries returns the delivery attempts made for a job, oldest first
+func (n *Notifier) Deliveries(jobID string) []Delivery {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	deliveries := make([]Delivery, len(n.deliveries[jobID]))
+	copy(deliveries, n.deliveries[jobID])
+	return deliveries
+}
+
+// CleanupDeliveries removes delivery logs whose last attempt is older than maxAge
+func (n *Notifier) CleanupDeliveries(maxAge time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	for jobID, deliveries := range n.deliveries {
+		if len(deliveries) > 0 && deliveries[len(deliveries)-1].AttemptAt.Before(cutoff) {
+			delete(n.deliveries, jobID)
+		}
+	}
+}
+
+// Sign computes the signature header value for a body sent at the given Unix timestamp
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver POSTs the payload, retrying with exponential backoff until it is accepted
+func (n *Notifier) deliver(jobID, url, secret string, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode webhook for job %s: %v", jobID, err)
+		return
+	}
+	if secret == "" {
+		secret = n.defaultSecret
+	}
+
+	deliveryID := uuid.New().String()
+	backoff := n.backoff
+
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		delivery := n.attempt(deliveryID, url, secret, payload.Event, body)
+		delivery.JobID = jobID
+		delivery.Attempt = attempt
+		n.record(delivery)
+
+		if delivery.Success {
+			return
+		}
+		if attempt < n.maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	log.Printf("Giving up on webhook for job %s after %d attempts", jobID, n.maxAttempts)
+}
+
+// attempt makes a single delivery attempt
+func (n *Notifier) attempt(deliveryID, url, secret, event string, body []byte) Delivery {
+	delivery := Delivery{
+		ID:        deliveryID,
+		Event:     event,
+		URL:       url,
+		AttemptAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), attemptTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := strconv.FormatInt(delivery.AttemptAt.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	resp, err := n.fetcher.Do(req)
+	delivery.DurationMs = time.Since(delivery.AttemptAt).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("receiver responded with HTTP %d", resp.StatusCode)
+	}
+	return delivery
+}
+
+// record appends a delivery attempt to the job's log
+func (n *Notifier) record(delivery Delivery) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.deliveries[delivery.JobID] = append(n.deliveries[delivery.JobID], delivery)
+}
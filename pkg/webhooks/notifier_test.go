@@ -0,0 +1,128 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vairarchi/bulk-import-export-api/internal/models"
+	"github.com/vairarchi/bulk-import-export-api/pkg/fetch"
+)
+
+// loopbackFetcher lets deliveries reach the test servers, which listen on loopback
+func loopbackFetcher() *fetch.Fetcher {
+	config := fetch.DefaultConfig()
+	config.AllowPrivateNetworks = true
+	return fetch.New(config)
+}
+
+func TestImportJobFinishedRetriesAndSigns(t *testing.T) {
+	received := make(chan *http.Request, 2)
+	bodies := make(chan []byte, 2)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := NewNotifier("server-secret")
+	n.SetFetcher(loopbackFetcher())
+	n.backoff = 10 * time.Millisecond
+
+	n.ImportJobFinished(models.ImportJob{
+		ID:          "job-1",
+		Status:      "completed",
+		CallbackURL: server.URL,
+		// No per-job secret, so the server secret signs the delivery
+	})
+
+	var req *http.Request
+	var body []byte
+	select {
+	case req = <-received:
+		body = <-bodies
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected webhook to be delivered after a retry")
+	}
+
+	if req.Header.Get(EventHeader) != "import.completed" {
+		t.Errorf("Expected event 'import.completed', got %s", req.Header.Get(EventHeader))
+	}
+	expected := Sign("server-secret", req.Header.Get(TimestampHeader), body)
+	if req.Header.Get(SignatureHeader) != expected {
+		t.Errorf("Expected signature %s, got %s", expected, req.Header.Get(SignatureHeader))
+	}
+
+	// The successful attempt is recorded right after the response is read
+	var deliveries []Delivery
+	for i := 0; i < 100; i++ {
+		if deliveries = n.Deliveries("job-1"); len(deliveries) == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected 2 delivery attempts, got %d", len(deliveries))
+	}
+	if deliveries[0].Success || deliveries[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected first attempt to fail with 503, got %+v", deliveries[0])
+	}
+	if !deliveries[1].Success || deliveries[1].Attempt != 2 {
+		t.Errorf("Expected second attempt to succeed, got %+v", deliveries[1])
+	}
+}
+
+func TestJobWithoutCallbackIsNotDelivered(t *testing.T) {
+	n := NewNotifier("")
+	n.ExportJobFinished(models.ExportJob{ID: "job-2", Status: "failed"})
+
+	if deliveries := n.Deliveries("job-2"); len(deliveries) != 0 {
+		t.Errorf("Expected no deliveries, got %d", len(deliveries))
+	}
+}
+
+func TestDeliveriesAreHeldToTheFetchPolicy(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	n := NewNotifier("")
+	if err := n.CheckURL("http://169.254.169.254/latest/meta-data"); err == nil {
+		t.Error("Expected a link-local callback URL to be rejected")
+	}
+
+	// localhost passes the URL check, so the address is refused as it connects
+	localhost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	delivery := n.attempt("delivery-1", localhost, "", "import.completed", []byte("{}"))
+	if delivery.Success || !strings.Contains(delivery.Error, "loopback address") {
+		t.Errorf("Expected the loopback address to be refused, got %+v", delivery)
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("Expected no request to reach the server, got %d", calls.Load())
+	}
+
+	// Redirects are capped, like those of a download
+	n.SetFetcher(loopbackFetcher())
+	delivery = n.attempt("delivery-2", server.URL, "", "import.completed", []byte("{}"))
+	if delivery.Success || !strings.Contains(delivery.Error, "redirects") {
+		t.Errorf("Expected the delivery to stop at the redirect limit, got %+v", delivery)
+	}
+	if max := int32(fetch.DefaultConfig().MaxRedirects) + 1; calls.Load() != max {
+		t.Errorf("Expected %d requests, got %d", max, calls.Load())
+	}
+}